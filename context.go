@@ -0,0 +1,39 @@
+package tracefall
+
+import "context"
+
+type ctxKey struct{}
+
+// ContextWithLog return new context that carries the log
+func ContextWithLog(ctx context.Context, l *Log) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// LogFromContext return log stored in context or nil if it absent
+func LogFromContext(ctx context.Context) *Log {
+	if ctx == nil {
+		return nil
+	}
+	l, _ := ctx.Value(ctxKey{}).(*Log)
+	return l
+}
+
+// StartChild create child of the log from context (or new root log if context has no log)
+// and return derived context with the new log
+func StartChild(ctx context.Context, name string) (context.Context, *Log, error) {
+	var (
+		l   *Log
+		err error
+	)
+
+	if parent := LogFromContext(ctx); parent != nil {
+		l, err = parent.CreateChild(name)
+		if err != nil {
+			return ctx, nil, err
+		}
+	} else {
+		l = NewLog(name)
+	}
+
+	return ContextWithLog(ctx, l), l, nil
+}
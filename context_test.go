@@ -0,0 +1,63 @@
+package tracefall
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestContext(t *testing.T) {
+
+	Convey("Log in Context", t, func() {
+
+		Convey("Empty context", func() {
+			So(LogFromContext(context.Background()), ShouldBeNil)
+		})
+
+		Convey("With Log", func() {
+			log := NewLog(`root`)
+			ctx := ContextWithLog(context.Background(), log)
+
+			So(LogFromContext(ctx), ShouldEqual, log)
+		})
+
+		Convey("Start Child: new root", func() {
+			ctx, log, err := StartChild(context.Background(), `root`)
+
+			So(err, ShouldBeNil)
+			So(log, ShouldNotBeNil)
+			So(log.Parent, ShouldBeNil)
+			So(log.Name, ShouldEqual, `root`)
+			So(LogFromContext(ctx), ShouldEqual, log)
+		})
+
+		Convey("Start Child: child of log from context", func() {
+			root := NewLog(`root`)
+			ctx := ContextWithLog(context.Background(), root)
+
+			childCtx, child, err := StartChild(ctx, `child`)
+
+			So(err, ShouldBeNil)
+			So(child.Parent, ShouldEqual, root)
+			So(child.Thread, ShouldEqual, root.Thread)
+			So(LogFromContext(childCtx), ShouldEqual, child)
+			So(LogFromContext(ctx), ShouldEqual, root)
+
+			_, subChild, err := StartChild(childCtx, `sub child`)
+			So(err, ShouldBeNil)
+			So(subChild.GetLevel(), ShouldEqual, 2)
+		})
+
+		Convey("Start Child: finished parent", func() {
+			root := NewLog(`root`).ThreadFinish()
+			ctx := ContextWithLog(context.Background(), root)
+
+			resCtx, child, err := StartChild(ctx, `child`)
+
+			So(err, ShouldEqual, ErrorParentFinish)
+			So(child, ShouldBeNil)
+			So(resCtx, ShouldEqual, ctx)
+		})
+	})
+}
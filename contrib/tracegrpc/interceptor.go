@@ -0,0 +1,354 @@
+package tracegrpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/efureev/tracefall"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Keys of Log.Data filled by the interceptors
+const (
+	DataMethod   = `method`
+	DataCode     = `code`
+	DataSent     = `sent`
+	DataReceived = `received`
+)
+
+// Option configures interceptors
+type Option func(*config)
+
+type config struct {
+	propagator tracefall.Propagator
+	onError    func(l *tracefall.Log, err error)
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		propagator: tracefall.DefaultPropagator(),
+		onError:    func(*tracefall.Log, error) {},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithPropagator set propagator of parent shadow metadata
+func WithPropagator(p tracefall.Propagator) Option {
+	return func(c *config) {
+		c.propagator = p
+	}
+}
+
+// WithErrorHandler set callback for errors of sending logs to storage
+func WithErrorHandler(fn func(l *tracefall.Log, err error)) Option {
+	return func(c *config) {
+		c.onError = fn
+	}
+}
+
+// MetadataCarrier adapts grpc metadata to tracefall.TextMapCarrier
+type MetadataCarrier metadata.MD
+
+// Get return value by key
+func (m MetadataCarrier) Get(key string) string {
+	if v := metadata.MD(m).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ``
+}
+
+// Set value by key
+func (m MetadataCarrier) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+// Keys return list of keys
+func (m MetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// UnaryServerInterceptor return interceptor which starts Log for every unary RPC
+func UnaryServerInterceptor(db *tracefall.DB, opts ...Option) grpc.UnaryServerInterceptor {
+	cfg := newConfig(opts)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		l := cfg.startServer(ctx, info.FullMethod)
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				cfg.finish(db, l, status.Errorf(codes.Internal, `panic: %v`, rec))
+				panic(rec)
+			}
+		}()
+
+		resp, err = handler(tracefall.ContextWithLog(ctx, l), req)
+
+		l.SetData(DataReceived, 1)
+		if err == nil {
+			l.SetData(DataSent, 1)
+		} else {
+			l.SetData(DataSent, 0)
+		}
+		cfg.finish(db, l, err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor return interceptor which starts Log for every streaming RPC
+func StreamServerInterceptor(db *tracefall.DB, opts ...Option) grpc.StreamServerInterceptor {
+	cfg := newConfig(opts)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		l := cfg.startServer(ss.Context(), info.FullMethod)
+		stream := &serverStream{ServerStream: ss, ctx: tracefall.ContextWithLog(ss.Context(), l)}
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				stream.setCounters(l)
+				cfg.finish(db, l, status.Errorf(codes.Internal, `panic: %v`, rec))
+				panic(rec)
+			}
+		}()
+
+		err = handler(srv, stream)
+
+		stream.setCounters(l)
+		cfg.finish(db, l, err)
+
+		return err
+	}
+}
+
+// UnaryClientInterceptor return interceptor which creates child Log for every outgoing unary RPC
+// and propagates its shadow via metadata
+func UnaryClientInterceptor(db *tracefall.DB, opts ...Option) grpc.UnaryClientInterceptor {
+	cfg := newConfig(opts)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		ctx, l, err := cfg.startClient(ctx, method)
+		if err != nil {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+
+		err = invoker(ctx, method, req, reply, cc, callOpts...)
+
+		l.SetData(DataSent, 1)
+		if err == nil {
+			l.SetData(DataReceived, 1)
+		} else {
+			l.SetData(DataReceived, 0)
+		}
+		cfg.finish(db, l, err)
+
+		return err
+	}
+}
+
+// StreamClientInterceptor return interceptor which creates child Log for every outgoing streaming RPC
+// and propagates its shadow via metadata. The Log is finished when the stream is over or its context is done
+func StreamClientInterceptor(db *tracefall.DB, opts ...Option) grpc.StreamClientInterceptor {
+	cfg := newConfig(opts)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, l, err := cfg.startClient(ctx, method)
+		if err != nil {
+			return streamer(ctx, desc, cc, method, callOpts...)
+		}
+
+		cs, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			l.SetData(DataSent, 0).SetData(DataReceived, 0)
+			cfg.finish(db, l, err)
+			return cs, err
+		}
+
+		stream := &clientStream{ClientStream: cs, serverStreams: desc.ServerStreams, finished: make(chan struct{})}
+		stream.done = func(err error) {
+			stream.setCounters(l)
+			cfg.finish(db, l, err)
+		}
+
+		// the stream may be abandoned by the caller without reading it to the end
+		go func() {
+			select {
+			case <-ctx.Done():
+				stream.finish(status.FromContextError(ctx.Err()).Err())
+			case <-stream.finished:
+			}
+		}()
+
+		return stream, nil
+	}
+}
+
+func (c *config) startServer(ctx context.Context, method string) *tracefall.Log {
+	if parent := tracefall.LogFromContext(ctx); parent != nil {
+		if l, err := parent.CreateChild(method); err == nil {
+			l.SetData(DataMethod, method)
+			return l
+		}
+	}
+
+	l := tracefall.NewLog(method)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if shadow, err := c.propagator.Extract(MetadataCarrier(md)); err == nil {
+			l.ParentFromShadow(shadow)
+		}
+	}
+	l.SetData(DataMethod, method)
+
+	return l
+}
+
+func (c *config) startClient(ctx context.Context, method string) (context.Context, *tracefall.Log, error) {
+	ctx, l, err := tracefall.StartChild(ctx, method)
+	if err != nil {
+		return ctx, nil, err
+	}
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	c.propagator.Inject(l.ToShadow(), MetadataCarrier(md))
+	l.SetData(DataMethod, method)
+
+	return metadata.NewOutgoingContext(ctx, md), l, nil
+}
+
+func (c *config) finish(db *tracefall.DB, l *tracefall.Log, err error) {
+	st := status.Convert(err)
+	l.SetData(DataCode, st.Code().String())
+
+	switch st.Code() {
+	case codes.OK:
+		l.Success()
+	case codes.DeadlineExceeded:
+		l.Timeout(fmt.Errorf(`%s: %w`, st.Code(), err))
+	case codes.Canceled:
+		l.Cancel(fmt.Errorf(`%s: %w`, st.Code(), err))
+	default:
+		l.Fail(fmt.Errorf(`%s: %w`, st.Code(), err))
+	}
+
+	if db == nil {
+		return
+	}
+	if _, err := db.Send(l); err != nil {
+		c.onError(l, err)
+	}
+}
+
+type counters struct {
+	mu             sync.Mutex
+	sent, received int
+}
+
+func (c *counters) incSent() {
+	c.mu.Lock()
+	c.sent++
+	c.mu.Unlock()
+}
+
+func (c *counters) incReceived() {
+	c.mu.Lock()
+	c.received++
+	c.mu.Unlock()
+}
+
+func (c *counters) setCounters(l *tracefall.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l.SetData(DataSent, c.sent).SetData(DataReceived, c.received)
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	counters
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.incSent()
+	}
+	return err
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.incReceived()
+	}
+	return err
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	counters
+	serverStreams bool
+	once          sync.Once
+	finished      chan struct{}
+	done          func(err error)
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.incSent()
+	} else if err != io.EOF {
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch err {
+	case nil:
+		s.incReceived()
+		if !s.serverStreams {
+			s.finish(nil)
+		}
+	case io.EOF:
+		s.finish(nil)
+	default:
+		s.finish(err)
+	}
+	return err
+}
+
+func (s *clientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err != nil {
+		s.finish(err)
+	}
+	return md, err
+}
+
+func (s *clientStream) finish(err error) {
+	s.once.Do(func() {
+		close(s.finished)
+		s.done(err)
+	})
+}
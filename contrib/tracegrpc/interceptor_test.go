@@ -0,0 +1,239 @@
+package tracegrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/efureev/tracefall"
+	"github.com/efureev/tracefall/internal/tracetest"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var testDriver = &tracetest.Driver{}
+
+const (
+	methodCheck = `/grpc.health.v1.Health/Check`
+	methodWatch = `/grpc.health.v1.Health/Watch`
+)
+
+func startServer(db *tracefall.DB) (*grpc.ClientConn, func()) {
+	lis := bufconn.Listen(1024 * 1024)
+
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(db)),
+		grpc.StreamInterceptor(StreamServerInterceptor(db)),
+	)
+	hs := health.NewServer()
+	hs.SetServingStatus(`tracer`, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+
+	go srv.Serve(lis)
+
+	conn, err := grpc.NewClient(`passthrough:///bufnet`,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(db)),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(db)),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return conn, func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
+
+// waitLogs waits for logs which are sent by the server side after the client has got the response
+func waitLogs(count int) []*tracefall.Log {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if logs := testDriver.Sent(); len(logs) >= count {
+			return logs
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return testDriver.Sent()
+}
+
+func TestInterceptors(t *testing.T) {
+
+	Convey("gRPC Interceptors", t, func() {
+		testDriver.Reset()
+		db, err := tracetest.OpenDB(testDriver)
+		So(err, ShouldBeNil)
+
+		conn, stop := startServer(db)
+		defer stop()
+
+		client := healthpb.NewHealthClient(conn)
+		root := tracefall.NewLog(`root`)
+		ctx := tracefall.ContextWithLog(context.Background(), root)
+
+		Convey("Unary", func() {
+			resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: `tracer`})
+			So(err, ShouldBeNil)
+			So(resp.Status, ShouldEqual, healthpb.HealthCheckResponse_SERVING)
+
+			So(len(waitLogs(2)), ShouldEqual, 2)
+
+			logs := testDriver.ByName(methodCheck)
+			So(len(logs), ShouldEqual, 2)
+
+			var server, clientLog *tracefall.Log
+			for _, l := range logs {
+				if l.Parent.ID == root.ID {
+					clientLog = l
+				} else {
+					server = l
+				}
+			}
+
+			So(clientLog, ShouldNotBeNil)
+			So(clientLog.Result, ShouldBeTrue)
+			So(clientLog.Data().Get(DataMethod), ShouldEqual, methodCheck)
+			So(clientLog.Data().Get(DataCode), ShouldEqual, codes.OK.String())
+			So(clientLog.Data().Get(DataSent), ShouldEqual, 1)
+			So(clientLog.Data().Get(DataReceived), ShouldEqual, 1)
+
+			So(server, ShouldNotBeNil)
+			So(server.Thread, ShouldEqual, root.Thread)
+			So(server.Parent.ID, ShouldEqual, clientLog.ID)
+			So(server.Result, ShouldBeTrue)
+			So(server.Data().Get(DataCode), ShouldEqual, codes.OK.String())
+		})
+
+		Convey("Unary: not OK status", func() {
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: `absent`})
+			So(status.Code(err), ShouldEqual, codes.NotFound)
+
+			logs := waitLogs(2)
+			So(len(logs), ShouldEqual, 2)
+
+			for _, l := range logs {
+				So(l.Result, ShouldBeFalse)
+				So(l.Status, ShouldEqual, tracefall.StatusFailed)
+				So(l.Error, ShouldBeError)
+				So(status.Code(l.Error), ShouldEqual, codes.NotFound)
+				So(l.Data().Get(DataCode), ShouldEqual, codes.NotFound.String())
+			}
+		})
+
+		Convey("Unary: deadline exceeded", func() {
+			deadlineCtx, cancel := context.WithTimeout(ctx, -time.Second)
+			defer cancel()
+
+			_, err := client.Check(deadlineCtx, &healthpb.HealthCheckRequest{Service: `tracer`})
+			So(status.Code(err), ShouldEqual, codes.DeadlineExceeded)
+
+			logs := waitLogs(1)
+			So(len(logs), ShouldEqual, 1)
+			So(logs[0].Status, ShouldEqual, tracefall.StatusTimeout)
+			So(status.Code(logs[0].Error), ShouldEqual, codes.DeadlineExceeded)
+			So(errors.Is(logs[0].Error, err), ShouldBeTrue)
+		})
+
+		Convey("Unary: existing outgoing metadata is kept", func() {
+			mdCtx := metadata.AppendToOutgoingContext(ctx, `x-key`, `value`)
+			_, err := client.Check(mdCtx, &healthpb.HealthCheckRequest{Service: `tracer`})
+			So(err, ShouldBeNil)
+
+			md, _ := metadata.FromOutgoingContext(mdCtx)
+			So(md.Get(`x-key`), ShouldResemble, []string{`value`})
+			So(md.Get(tracefall.HeaderTraceParent), ShouldBeEmpty)
+		})
+
+		Convey("Server stream", func() {
+			streamCtx, cancel := context.WithCancel(ctx)
+			stream, err := client.Watch(streamCtx, &healthpb.HealthCheckRequest{Service: `tracer`})
+			So(err, ShouldBeNil)
+
+			resp, err := stream.Recv()
+			So(err, ShouldBeNil)
+			So(resp.Status, ShouldEqual, healthpb.HealthCheckResponse_SERVING)
+
+			cancel()
+			_, err = stream.Recv()
+			So(status.Code(err), ShouldEqual, codes.Canceled)
+
+			So(len(waitLogs(2)), ShouldEqual, 2)
+
+			var server, clientLog *tracefall.Log
+			for _, l := range testDriver.ByName(methodWatch) {
+				if l.Parent.ID == root.ID {
+					clientLog = l
+				} else {
+					server = l
+				}
+			}
+
+			So(clientLog, ShouldNotBeNil)
+			So(clientLog.Result, ShouldBeFalse)
+			So(clientLog.Status, ShouldEqual, tracefall.StatusCancelled)
+			So(clientLog.Data().Get(DataCode), ShouldEqual, codes.Canceled.String())
+			So(clientLog.Data().Get(DataSent), ShouldEqual, 1)
+			So(clientLog.Data().Get(DataReceived), ShouldEqual, 1)
+
+			So(server, ShouldNotBeNil)
+			So(server.Parent.ID, ShouldEqual, clientLog.ID)
+			So(server.Thread, ShouldEqual, root.Thread)
+			So(server.Data().Get(DataSent), ShouldEqual, 1)
+			So(server.Data().Get(DataReceived), ShouldEqual, 1)
+		})
+
+		Convey("Server stream: abandoned", func() {
+			streamCtx, cancel := context.WithCancel(ctx)
+			stream, err := client.Watch(streamCtx, &healthpb.HealthCheckRequest{Service: `tracer`})
+			So(err, ShouldBeNil)
+
+			_, err = stream.Recv()
+			So(err, ShouldBeNil)
+
+			// the stream is not read after cancel
+			cancel()
+
+			So(len(waitLogs(2)), ShouldEqual, 2)
+
+			var clientLog *tracefall.Log
+			for _, l := range testDriver.ByName(methodWatch) {
+				if l.Parent.ID == root.ID {
+					clientLog = l
+				}
+			}
+
+			So(clientLog, ShouldNotBeNil)
+			So(clientLog.Status, ShouldEqual, tracefall.StatusCancelled)
+			So(clientLog.Data().Get(DataCode), ShouldEqual, codes.Canceled.String())
+			So(clientLog.Data().Get(DataReceived), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestMetadataCarrier(t *testing.T) {
+
+	Convey("Metadata Carrier", t, func() {
+		md := metadata.MD{}
+		c := MetadataCarrier(md)
+
+		c.Set(`X-B3-TraceId`, `value`)
+
+		So(md.Get(`x-b3-traceid`), ShouldResemble, []string{`value`})
+		So(c.Get(`X-B3-TraceId`), ShouldEqual, `value`)
+		So(c.Get(`absent`), ShouldBeEmpty)
+		So(c.Keys(), ShouldResemble, []string{`x-b3-traceid`})
+	})
+}
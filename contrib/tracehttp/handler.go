@@ -0,0 +1,211 @@
+package tracehttp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/efureev/tracefall"
+)
+
+// Keys of Log.Data filled by the middleware and the transport
+const (
+	DataMethod   = `method`
+	DataURL      = `url`
+	DataStatus   = `status`
+	DataSize     = `size`
+	DataClientIP = `clientIP`
+)
+
+// Option configures middleware and transport
+type Option func(*config)
+
+type config struct {
+	propagator   tracefall.Propagator
+	nameFunc     func(r *http.Request) string
+	onError      func(l *tracefall.Log, err error)
+	proxyHeaders bool
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		propagator: tracefall.DefaultPropagator(),
+		nameFunc:   defaultName,
+		onError:    func(*tracefall.Log, error) {},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithPropagator set propagator of parent shadow headers
+func WithPropagator(p tracefall.Propagator) Option {
+	return func(c *config) {
+		c.propagator = p
+	}
+}
+
+// WithNameFunc set function which makes the Log name from request
+func WithNameFunc(fn func(r *http.Request) string) Option {
+	return func(c *config) {
+		c.nameFunc = fn
+	}
+}
+
+// WithErrorHandler set callback for errors of sending logs to storage
+func WithErrorHandler(fn func(l *tracefall.Log, err error)) Option {
+	return func(c *config) {
+		c.onError = fn
+	}
+}
+
+// WithTrustedProxyHeaders take client IP from headers `X-Forwarded-For` and `X-Real-Ip`. Headers are set by clients,
+// so they are to be trusted only behind proxy which overwrites them. Client IP is taken from RemoteAddr by default
+func WithTrustedProxyHeaders() Option {
+	return func(c *config) {
+		c.proxyHeaders = true
+	}
+}
+
+func defaultName(r *http.Request) string {
+	return r.Method + ` ` + r.URL.Path
+}
+
+// Middleware return http middleware which starts Log for every request.
+// Parent shadow is extracted from incoming headers, the Log is stored in the request context
+// and sent to db when the request is finished
+func Middleware(db *tracefall.DB, opts ...Option) func(http.Handler) http.Handler {
+	cfg := newConfig(opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l := tracefall.NewLog(cfg.nameFunc(r))
+			if shadow, err := cfg.propagator.Extract(tracefall.HeaderCarrier(r.Header)); err == nil {
+				l.ParentFromShadow(shadow)
+			}
+
+			l.SetData(DataMethod, r.Method).
+				SetData(DataURL, r.URL.String()).
+				SetData(DataClientIP, clientIP(r, cfg.proxyHeaders))
+
+			// route of ServeMux is known before the request is served, so handlers see it as the name
+			if name := routeName(next, r); name != `` {
+				l.SetName(name)
+			}
+
+			rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+			req := r.WithContext(tracefall.ContextWithLog(r.Context(), l))
+
+			defer func() {
+				rec := recover()
+
+				// pattern of nested ServeMux is set to the request while it is served
+				if req.Pattern != `` {
+					l.SetName(req.Pattern)
+				}
+				l.SetData(DataSize, rw.size)
+
+				switch {
+				case rec != nil:
+					l.SetData(DataStatus, http.StatusInternalServerError)
+					l.Fail(&tracefall.PanicError{Value: rec})
+				case rw.status >= http.StatusInternalServerError:
+					l.SetData(DataStatus, rw.status)
+					l.Fail(fmt.Errorf(`%d %s`, rw.status, http.StatusText(rw.status)))
+				default:
+					l.SetData(DataStatus, rw.status)
+					l.Success()
+				}
+
+				send(db, cfg, l)
+
+				if rec != nil {
+					panic(rec)
+				}
+			}()
+
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
+
+// routeName return pattern of the route of ServeMux which serves the request: `GET /items/{id}`
+func routeName(h http.Handler, r *http.Request) string {
+	mux, ok := h.(*http.ServeMux)
+	if !ok {
+		return ``
+	}
+	_, pattern := mux.Handler(r)
+	return pattern
+}
+
+func send(db *tracefall.DB, cfg *config, l *tracefall.Log) {
+	if db == nil {
+		return
+	}
+	if _, err := db.Send(l); err != nil {
+		cfg.onError(l, err)
+	}
+}
+
+// clientIP return IP of the client from RemoteAddr or from headers of proxy if they are trusted
+func clientIP(r *http.Request, proxyHeaders bool) string {
+	if proxyHeaders {
+		if xff := r.Header.Get(`X-Forwarded-For`); xff != `` {
+			return strings.TrimSpace(strings.Split(xff, `,`)[0])
+		}
+		if ip := r.Header.Get(`X-Real-Ip`); ip != `` {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the original ResponseWriter implements it
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf(`%w: %T is not http.Hijacker`, http.ErrNotSupported, w.ResponseWriter)
+	}
+	return h.Hijack()
+}
+
+// Unwrap return original ResponseWriter for http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,192 @@
+package tracehttp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/efureev/tracefall"
+	"github.com/efureev/tracefall/internal/tracetest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var testDriver = &tracetest.Driver{}
+
+func TestMiddleware(t *testing.T) {
+
+	Convey("HTTP Middleware", t, func() {
+		testDriver.Reset()
+		db, err := tracetest.OpenDB(testDriver)
+		So(err, ShouldBeNil)
+
+		mux := http.NewServeMux()
+		mux.HandleFunc(`GET /items/{id}`, func(w http.ResponseWriter, r *http.Request) {
+			l := tracefall.LogFromContext(r.Context())
+			l.AddNote(`handler`, tracefall.NewNote(`item `+r.PathValue(`id`)))
+			l.SetData(`nameInHandler`, l.ToLogJSON().Name)
+			w.Write([]byte(`hello`))
+		})
+		mux.HandleFunc(`/fail`, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		mux.HandleFunc(`/panic`, func(w http.ResponseWriter, r *http.Request) {
+			panic(`boom`)
+		})
+
+		handler := Middleware(db)(mux)
+
+		Convey("Success request", func() {
+			req := httptest.NewRequest(`GET`, `/items/42?q=1`, nil)
+			req.RemoteAddr = `10.0.0.1:5555`
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			So(rec.Body.String(), ShouldEqual, `hello`)
+
+			logs := testDriver.Sent()
+			So(len(logs), ShouldEqual, 1)
+
+			l := logs[0]
+			So(l.Name, ShouldEqual, `GET /items/{id}`)
+			So(l.Data().Get(`nameInHandler`), ShouldEqual, `GET /items/{id}`)
+			So(l.Result, ShouldBeTrue)
+			So(l.TimeEnd, ShouldNotBeNil)
+			So(l.Parent, ShouldBeNil)
+			So(l.Data().Get(DataMethod), ShouldEqual, `GET`)
+			So(l.Data().Get(DataURL), ShouldEqual, `/items/42?q=1`)
+			So(l.Data().Get(DataStatus), ShouldEqual, http.StatusOK)
+			So(l.Data().Get(DataSize), ShouldEqual, 5)
+			So(l.Data().Get(DataClientIP), ShouldEqual, `10.0.0.1`)
+			So(l.Notes().Get(`handler`).Count(), ShouldEqual, 1)
+		})
+
+		Convey("Parent from headers", func() {
+			parent := tracefall.NewLog(`client`)
+			req := httptest.NewRequest(`GET`, `/items/1`, nil)
+			req.Header.Set(`X-Forwarded-For`, `1.2.3.4, 10.0.0.1`)
+			tracefall.DefaultPropagator().Inject(parent.ToShadow(), tracefall.HeaderCarrier(req.Header))
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			l := testDriver.Sent()[0]
+			So(l.Thread, ShouldEqual, parent.Thread)
+			So(l.Parent.ID, ShouldEqual, parent.ID)
+			So(l.Data().Get(DataClientIP), ShouldEqual, `192.0.2.1`)
+		})
+
+		Convey("Trusted proxy headers", func() {
+			h := Middleware(db, WithTrustedProxyHeaders())(mux)
+
+			req := httptest.NewRequest(`GET`, `/items/1`, nil)
+			req.Header.Set(`X-Forwarded-For`, `1.2.3.4, 10.0.0.1`)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			req = httptest.NewRequest(`GET`, `/items/2`, nil)
+			req.Header.Set(`X-Real-Ip`, `5.6.7.8`)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/items/3`, nil))
+
+			logs := testDriver.Sent()
+			So(logs[0].Data().Get(DataClientIP), ShouldEqual, `1.2.3.4`)
+			So(logs[1].Data().Get(DataClientIP), ShouldEqual, `5.6.7.8`)
+			So(logs[2].Data().Get(DataClientIP), ShouldEqual, `192.0.2.1`)
+		})
+
+		Convey("5xx response", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(`POST`, `/fail`, nil))
+
+			l := testDriver.Sent()[0]
+			So(l.Result, ShouldBeFalse)
+			So(l.Error, ShouldBeError)
+			So(l.Data().Get(DataStatus), ShouldEqual, http.StatusBadGateway)
+		})
+
+		Convey("Panic", func() {
+			So(func() {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/panic`, nil))
+			}, ShouldPanicWith, `boom`)
+
+			l := testDriver.Sent()[0]
+			So(l.Result, ShouldBeFalse)
+			So(l.Error.Error(), ShouldEqual, `panic: boom`)
+			So(l.Error, ShouldHaveSameTypeAs, &tracefall.PanicError{})
+			So(l.ErrorInfo.Type, ShouldEqual, `*tracefall.PanicError`)
+			So(l.Data().Get(DataStatus), ShouldEqual, http.StatusInternalServerError)
+		})
+
+		Convey("Nested mux", func() {
+			api := http.NewServeMux()
+			api.HandleFunc(`GET /api/users/{id}`, func(w http.ResponseWriter, r *http.Request) {})
+			root := http.NewServeMux()
+			root.Handle(`/api/`, api)
+
+			Middleware(db)(root).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/api/users/1`, nil))
+
+			So(testDriver.Sent()[0].Name, ShouldEqual, `GET /api/users/{id}`)
+		})
+
+		Convey("Custom name", func() {
+			h := Middleware(db, WithNameFunc(func(r *http.Request) string {
+				return `custom`
+			}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/`, nil))
+
+			So(testDriver.Sent()[0].Name, ShouldEqual, `custom`)
+		})
+
+		Convey("Response controller", func() {
+			var flushErr, hijackErr error
+			h := Middleware(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rc := http.NewResponseController(w)
+				w.Write([]byte(`chunk`))
+				flushErr = rc.Flush()
+				_, _, hijackErr = rc.Hijack()
+			}))
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(`GET`, `/`, nil))
+
+			So(flushErr, ShouldBeNil)
+			So(rec.Flushed, ShouldBeTrue)
+			So(errors.Is(hijackErr, http.ErrNotSupported), ShouldBeTrue)
+			So(testDriver.Sent()[0].Data().Get(DataSize), ShouldEqual, 5)
+		})
+
+		Convey("Hijack", func() {
+			srv := httptest.NewServer(Middleware(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, buf, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				defer conn.Close()
+
+				buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+				buf.Flush()
+			})))
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			So(string(body), ShouldEqual, `hijacked`)
+		})
+
+		Convey("Without storage", func() {
+			h := Middleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				So(tracefall.LogFromContext(r.Context()), ShouldNotBeNil)
+			}))
+
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(`GET`, `/`, nil))
+
+			So(len(testDriver.Sent()), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,59 @@
+package tracehttp
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/efureev/tracefall"
+)
+
+// Transport is http.RoundTripper which creates child Log for every outgoing request
+// and injects its shadow to the request headers
+type Transport struct {
+	base http.RoundTripper
+	db   *tracefall.DB
+	cfg  *config
+}
+
+// NewTransport create new Transport over base RoundTripper (http.DefaultTransport if nil)
+func NewTransport(db *tracefall.DB, base http.RoundTripper, opts ...Option) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{base: base, db: db, cfg: newConfig(opts)}
+}
+
+// RoundTrip executes http transaction
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, l, err := tracefall.StartChild(r.Context(), t.cfg.nameFunc(r))
+	if err != nil {
+		return t.base.RoundTrip(r)
+	}
+
+	req := r.Clone(ctx)
+	t.cfg.propagator.Inject(l.ToShadow(), tracefall.HeaderCarrier(req.Header))
+
+	l.SetData(DataMethod, req.Method).
+		SetData(DataURL, req.URL.String())
+
+	resp, err := t.base.RoundTrip(req)
+
+	switch {
+	case err != nil:
+		l.Fail(err)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		l.SetData(DataStatus, resp.StatusCode)
+		l.Fail(fmt.Errorf(`%d %s`, resp.StatusCode, http.StatusText(resp.StatusCode)))
+	default:
+		l.SetData(DataStatus, resp.StatusCode)
+		l.Success()
+	}
+
+	if resp != nil && resp.ContentLength >= 0 {
+		l.SetData(DataSize, resp.ContentLength)
+	}
+
+	send(t.db, t.cfg, l)
+
+	return resp, err
+}
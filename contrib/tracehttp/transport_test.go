@@ -0,0 +1,109 @@
+package tracehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/efureev/tracefall"
+	"github.com/efureev/tracefall/internal/tracetest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestTransport(t *testing.T) {
+
+	Convey("HTTP Transport", t, func() {
+		testDriver.Reset()
+		db, err := tracetest.OpenDB(testDriver)
+		So(err, ShouldBeNil)
+
+		Convey("Request chain lands in one thread", func() {
+			backend := httptest.NewServer(Middleware(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`pong`))
+			})))
+			defer backend.Close()
+
+			client := &http.Client{Transport: NewTransport(db, nil)}
+
+			root := tracefall.NewLog(`root`)
+			ctx := tracefall.ContextWithLog(context.Background(), root)
+
+			req, _ := http.NewRequestWithContext(ctx, `GET`, backend.URL+`/ping`, nil)
+			resp, err := client.Do(req)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+
+			So(req.Header.Get(tracefall.HeaderTraceParent), ShouldBeEmpty)
+
+			logs := testDriver.Sent()
+			So(len(logs), ShouldEqual, 2)
+
+			server, clientLog := logs[0], logs[1]
+
+			So(clientLog.Name, ShouldEqual, `GET /ping`)
+			So(clientLog.Parent.ID, ShouldEqual, root.ID)
+			So(clientLog.Result, ShouldBeTrue)
+			So(clientLog.Data().Get(DataStatus), ShouldEqual, http.StatusOK)
+			So(clientLog.Data().Get(DataSize), ShouldEqual, int64(4))
+
+			So(server.Thread, ShouldEqual, root.Thread)
+			So(server.Parent.ID, ShouldEqual, clientLog.ID)
+		})
+
+		Convey("Root log without context", func() {
+			var header http.Header
+			tr := NewTransport(db, roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				header = r.Header
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, ContentLength: -1}, nil
+			}))
+
+			req, _ := http.NewRequest(`GET`, `http://example.com/`, nil)
+			_, err := tr.RoundTrip(req)
+			So(err, ShouldBeNil)
+
+			l := testDriver.Sent()[0]
+			So(l.Parent, ShouldBeNil)
+			So(l.Result, ShouldBeFalse)
+			So(l.Data().Get(DataSize), ShouldBeNil)
+			So(header.Get(tracefall.HeaderTraceParent), ShouldNotBeEmpty)
+		})
+
+		Convey("Transport error", func() {
+			tr := NewTransport(db, roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				return nil, errors.New(`refused`)
+			}))
+
+			req, _ := http.NewRequest(`GET`, `http://example.com/`, nil)
+			_, err := tr.RoundTrip(req)
+			So(err, ShouldBeError)
+
+			l := testDriver.Sent()[0]
+			So(l.Result, ShouldBeFalse)
+			So(l.Error.Error(), ShouldEqual, `refused`)
+		})
+
+		Convey("Finished parent is not traced", func() {
+			called := false
+			tr := NewTransport(db, roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				called = true
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			}))
+
+			ctx := tracefall.ContextWithLog(context.Background(), tracefall.NewLog(`root`).ThreadFinish())
+			req, _ := http.NewRequestWithContext(ctx, `GET`, `http://example.com/`, nil)
+			_, err := tr.RoundTrip(req)
+
+			So(err, ShouldBeNil)
+			So(called, ShouldBeTrue)
+			So(len(testDriver.Sent()), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package tracemq
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AMQPCarrier adapts AMQP table headers (amqp.Table) to tracefall.TextMapCarrier
+type AMQPCarrier map[string]interface{}
+
+// Get return value by key
+func (c AMQPCarrier) Get(key string) string {
+	if v, ok := c[key]; ok {
+		return headerString(v)
+	}
+	for k, v := range c {
+		if strings.EqualFold(k, key) {
+			return headerString(v)
+		}
+	}
+	return ``
+}
+
+// Set value by key
+func (c AMQPCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// Keys return list of keys
+func (c AMQPCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func headerString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case nil:
+		return ``
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// KafkaHeader is header of Kafka record
+type KafkaHeader struct {
+	Key   string
+	Value []byte
+}
+
+// KafkaCarrier adapts Kafka record headers to tracefall.TextMapCarrier
+type KafkaCarrier []KafkaHeader
+
+// Get return value by key
+func (c *KafkaCarrier) Get(key string) string {
+	for _, h := range *c {
+		if strings.EqualFold(h.Key, key) {
+			return string(h.Value)
+		}
+	}
+	return ``
+}
+
+// Set value by key. Existing header with the same key is replaced
+func (c *KafkaCarrier) Set(key, value string) {
+	for i, h := range *c {
+		if strings.EqualFold(h.Key, key) {
+			(*c)[i] = KafkaHeader{Key: key, Value: []byte(value)}
+			return
+		}
+	}
+	*c = append(*c, KafkaHeader{Key: key, Value: []byte(value)})
+}
+
+// Keys return list of keys
+func (c *KafkaCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c))
+	for _, h := range *c {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
@@ -0,0 +1,50 @@
+package tracemq
+
+import (
+	"testing"
+
+	"github.com/efureev/tracefall"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAMQPCarrier(t *testing.T) {
+
+	Convey("AMQP Carrier", t, func() {
+		headers := map[string]interface{}{
+			`X-B3-TraceId`: []byte(`bytes`),
+			`number`:       int32(5),
+			`nil`:          nil,
+		}
+		c := AMQPCarrier(headers)
+		c.Set(`traceparent`, `value`)
+
+		So(headers[`traceparent`], ShouldEqual, `value`)
+		So(c.Get(`traceparent`), ShouldEqual, `value`)
+		So(c.Get(`x-b3-traceid`), ShouldEqual, `bytes`)
+		So(c.Get(`number`), ShouldEqual, `5`)
+		So(c.Get(`nil`), ShouldBeEmpty)
+		So(c.Get(`absent`), ShouldBeEmpty)
+		So(len(c.Keys()), ShouldEqual, 4)
+	})
+}
+
+func TestKafkaCarrier(t *testing.T) {
+
+	Convey("Kafka Carrier", t, func() {
+		c := KafkaCarrier{{Key: `key`, Value: []byte(`val`)}}
+
+		c.Set(`traceparent`, `value`)
+		So(len(c), ShouldEqual, 2)
+		So(c.Get(`TraceParent`), ShouldEqual, `value`)
+
+		c.Set(`traceparent`, `value 2`)
+		So(len(c), ShouldEqual, 2)
+		So(c.Get(`traceparent`), ShouldEqual, `value 2`)
+
+		So(c.Get(`absent`), ShouldBeEmpty)
+		So(c.Keys(), ShouldResemble, []string{`key`, `traceparent`})
+
+		var carrier tracefall.TextMapCarrier = &c
+		So(carrier.Get(`key`), ShouldEqual, `val`)
+	})
+}
@@ -0,0 +1,105 @@
+package tracemq
+
+import (
+	"github.com/efureev/tracefall"
+)
+
+// Keys of Log.Data filled by the consumer helpers
+const (
+	DataQueue      = `queue`
+	DataExchange   = `exchange`
+	DataRoutingKey = `routingKey`
+	DataTopic      = `topic`
+	DataPartition  = `partition`
+	DataOffset     = `offset`
+)
+
+// Option configures helpers
+type Option func(*config)
+
+type config struct {
+	propagator tracefall.Propagator
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{propagator: tracefall.DefaultPropagator()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithPropagator set propagator of parent shadow headers
+func WithPropagator(p tracefall.Propagator) Option {
+	return func(c *config) {
+		c.propagator = p
+	}
+}
+
+// AMQPMessage is consumed AMQP delivery
+type AMQPMessage struct {
+	Queue      string
+	Exchange   string
+	RoutingKey string
+	Headers    map[string]interface{}
+}
+
+// KafkaMessage is consumed Kafka record
+type KafkaMessage struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Headers   []KafkaHeader
+}
+
+// InjectAMQP put shadow of the log to AMQP headers. Headers are created if nil
+func InjectAMQP(l *tracefall.Log, headers map[string]interface{}, opts ...Option) map[string]interface{} {
+	if headers == nil {
+		headers = make(map[string]interface{})
+	}
+	newConfig(opts).propagator.Inject(l.ToShadow(), AMQPCarrier(headers))
+	return headers
+}
+
+// InjectKafka put shadow of the log to Kafka headers
+func InjectKafka(l *tracefall.Log, headers []KafkaHeader, opts ...Option) []KafkaHeader {
+	c := KafkaCarrier(headers)
+	newConfig(opts).propagator.Inject(l.ToShadow(), &c)
+	return c
+}
+
+// ConsumeAMQP start new Log for consumed AMQP message.
+// The Log continues the thread of shadow from message headers (if it present)
+func ConsumeAMQP(name string, msg AMQPMessage, opts ...Option) *tracefall.Log {
+	l := start(name, AMQPCarrier(msg.Headers), newConfig(opts))
+	l.SetData(DataQueue, msg.Queue)
+
+	if msg.Exchange != `` {
+		l.SetData(DataExchange, msg.Exchange)
+	}
+	if msg.RoutingKey != `` {
+		l.SetData(DataRoutingKey, msg.RoutingKey)
+	}
+
+	return l
+}
+
+// ConsumeKafka start new Log for consumed Kafka record.
+// The Log continues the thread of shadow from record headers (if it present)
+func ConsumeKafka(name string, msg KafkaMessage, opts ...Option) *tracefall.Log {
+	c := KafkaCarrier(msg.Headers)
+	l := start(name, &c, newConfig(opts))
+	l.SetData(DataTopic, msg.Topic).
+		SetData(DataPartition, msg.Partition).
+		SetData(DataOffset, msg.Offset)
+
+	return l
+}
+
+func start(name string, carrier tracefall.TextMapCarrier, cfg *config) *tracefall.Log {
+	l := tracefall.NewLog(name)
+	if shadow, err := cfg.propagator.Extract(carrier); err == nil {
+		l.ParentFromShadow(shadow)
+	}
+	return l
+}
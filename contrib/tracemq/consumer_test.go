@@ -0,0 +1,90 @@
+package tracemq
+
+import (
+	"testing"
+
+	"github.com/efureev/tracefall"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAMQP(t *testing.T) {
+
+	Convey("AMQP helpers", t, func() {
+		parent := tracefall.NewLog(`publisher`)
+
+		Convey("Inject to nil headers", func() {
+			headers := InjectAMQP(parent, nil)
+
+			So(headers[tracefall.HeaderTraceParent], ShouldNotBeEmpty)
+			So(headers[tracefall.HeaderB3TraceID], ShouldNotBeEmpty)
+		})
+
+		Convey("Consume", func() {
+			headers := InjectAMQP(parent, map[string]interface{}{`app`: `value`})
+			So(headers[`app`], ShouldEqual, `value`)
+
+			l := ConsumeAMQP(`process job`, AMQPMessage{
+				Queue:      `jobs`,
+				Exchange:   `events`,
+				RoutingKey: `job.created`,
+				Headers:    headers,
+			})
+
+			So(l.Name, ShouldEqual, `process job`)
+			So(l.Thread, ShouldEqual, parent.Thread)
+			So(l.Parent.ID, ShouldEqual, parent.ID)
+			So(l.Data().Get(DataQueue), ShouldEqual, `jobs`)
+			So(l.Data().Get(DataExchange), ShouldEqual, `events`)
+			So(l.Data().Get(DataRoutingKey), ShouldEqual, `job.created`)
+		})
+
+		Convey("Consume without shadow", func() {
+			l := ConsumeAMQP(`process job`, AMQPMessage{Queue: `jobs`})
+
+			So(l.Parent, ShouldBeNil)
+			So(l.Thread, ShouldEqual, l.ID)
+			So(l.Data().Get(DataQueue), ShouldEqual, `jobs`)
+			So(l.Data().Get(DataExchange), ShouldBeNil)
+		})
+
+		Convey("Custom propagator", func() {
+			headers := InjectAMQP(parent, nil, WithPropagator(tracefall.B3{SingleHeader: true}))
+			So(len(headers), ShouldEqual, 1)
+
+			l := ConsumeAMQP(`job`, AMQPMessage{Headers: headers})
+			So(l.Thread, ShouldEqual, parent.Thread)
+		})
+	})
+}
+
+func TestKafka(t *testing.T) {
+
+	Convey("Kafka helpers", t, func() {
+		parent := tracefall.NewLog(`producer`)
+
+		Convey("Consume", func() {
+			headers := InjectKafka(parent, []KafkaHeader{{Key: `app`, Value: []byte(`value`)}})
+			So(len(headers), ShouldEqual, 6)
+
+			l := ConsumeKafka(`process event`, KafkaMessage{
+				Topic:     `events`,
+				Partition: 3,
+				Offset:    42,
+				Headers:   headers,
+			})
+
+			So(l.Thread, ShouldEqual, parent.Thread)
+			So(l.Parent.ID, ShouldEqual, parent.ID)
+			So(l.Data().Get(DataTopic), ShouldEqual, `events`)
+			So(l.Data().Get(DataPartition), ShouldEqual, int32(3))
+			So(l.Data().Get(DataOffset), ShouldEqual, int64(42))
+		})
+
+		Convey("Consume without shadow", func() {
+			l := ConsumeKafka(`process event`, KafkaMessage{Topic: `events`})
+
+			So(l.Parent, ShouldBeNil)
+			So(l.Data().Get(DataTopic), ShouldEqual, `events`)
+		})
+	})
+}
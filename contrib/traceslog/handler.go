@@ -0,0 +1,207 @@
+package traceslog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+
+	"github.com/efureev/tracefall"
+)
+
+// DefaultNoteGroup is label of the note group which records are added to
+const DefaultNoteGroup = `log`
+
+// Option configures handler
+type Option func(*config)
+
+type config struct {
+	group       string
+	level       slog.Leveler
+	failOnError bool
+	addSource   bool
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		group: DefaultNoteGroup,
+		level: slog.LevelDebug,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithNoteGroup set label of the note group for records
+func WithNoteGroup(label string) Option {
+	return func(c *config) {
+		c.group = label
+	}
+}
+
+// WithLevel set minimal level of records which are added to the Log as notes
+func WithLevel(level slog.Leveler) Option {
+	return func(c *config) {
+		c.level = level
+	}
+}
+
+// WithFailOnError mark the Log failed on records with Error level and above
+func WithFailOnError() Option {
+	return func(c *config) {
+		c.failOnError = true
+	}
+}
+
+// WithSource add source location (file:line) of records to notes
+func WithSource() Option {
+	return func(c *config) {
+		c.addSource = true
+	}
+}
+
+// Handler is slog.Handler which appends records as notes to the Log found in the context
+// and forwards them to the wrapped handler
+type Handler struct {
+	next   slog.Handler
+	cfg    *config
+	attrs  []tracefall.Attr
+	prefix string
+}
+
+// NewHandler create new Handler. The next handler may be nil: records are only added to the Log then
+func NewHandler(next slog.Handler, opts ...Option) *Handler {
+	return &Handler{next: next, cfg: newConfig(opts)}
+}
+
+// Enabled reports whether the record with level is handled by the Log in the context or by the next handler
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	if tracefall.LogFromContext(ctx) != nil && level >= h.cfg.level.Level() {
+		return true
+	}
+	return h.next != nil && h.next.Enabled(ctx, level)
+}
+
+// Handle add the record to the Log in the context and pass it to the next handler
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if l := tracefall.LogFromContext(ctx); l != nil && r.Level >= h.cfg.level.Level() {
+		h.addNote(l, r)
+	}
+
+	if h.next != nil && h.next.Enabled(ctx, r.Level) {
+		return h.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+// WithAttrs return new Handler with attributes which are added to every record
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	c := h.clone()
+	for _, a := range attrs {
+		c.attrs = appendAttr(c.attrs, c.prefix, a)
+	}
+	if h.next != nil {
+		c.next = h.next.WithAttrs(attrs)
+	}
+	return c
+}
+
+// WithGroup return new Handler which qualifies keys of further attributes by group name
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == `` {
+		return h
+	}
+
+	c := h.clone()
+	c.prefix = h.prefix + name + `.`
+	if h.next != nil {
+		c.next = h.next.WithGroup(name)
+	}
+	return c
+}
+
+func (h *Handler) clone() *Handler {
+	return &Handler{
+		next:   h.next,
+		cfg:    h.cfg,
+		attrs:  append([]tracefall.Attr{}, h.attrs...),
+		prefix: h.prefix,
+	}
+}
+
+func (h *Handler) addNote(l *tracefall.Log, r slog.Record) {
+	attrs := append([]tracefall.Attr{}, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = appendAttr(attrs, h.prefix, a)
+		return true
+	})
+
+	// errors are attached to the note and kept in attributes as text
+	var err error
+	for i, a := range attrs {
+		if e, ok := a.Value.(error); ok {
+			if err == nil {
+				err = e
+			}
+			attrs[i].Value = e.Error()
+		}
+	}
+
+	note := tracefall.NewLevelNote(Level(r.Level), r.Message, attrs...).SetError(err)
+	if !r.Time.IsZero() {
+		note.Time = r.Time.UnixNano()
+	}
+	if h.cfg.addSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		note.Source = fmt.Sprintf(`%s:%d`, filepath.Join(filepath.Base(filepath.Dir(frame.File)), filepath.Base(frame.File)), frame.Line)
+	}
+
+	l.AddNote(h.cfg.group, note)
+
+	if h.cfg.failOnError && r.Level >= slog.LevelError {
+		if err == nil {
+			err = errors.New(r.Message)
+		}
+		l.Fail(err)
+	}
+}
+
+// Level convert slog level to note level
+func Level(level slog.Level) tracefall.NoteLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return tracefall.LevelDebug
+	case level < slog.LevelWarn:
+		return tracefall.LevelInfo
+	case level < slog.LevelError:
+		return tracefall.LevelWarn
+	default:
+		return tracefall.LevelError
+	}
+}
+
+func appendAttr(attrs []tracefall.Attr, prefix string, a slog.Attr) []tracefall.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return attrs
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != `` {
+			prefix += a.Key + `.`
+		}
+		for _, ga := range a.Value.Group() {
+			attrs = appendAttr(attrs, prefix, ga)
+		}
+		return attrs
+	}
+
+	return append(attrs, tracefall.NewAttr(prefix+a.Key, a.Value.Any()))
+}
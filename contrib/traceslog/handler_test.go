@@ -0,0 +1,115 @@
+package traceslog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/efureev/tracefall"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHandler(t *testing.T) {
+
+	Convey("slog Handler", t, func() {
+		var buf bytes.Buffer
+		next := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+
+		l := tracefall.NewLog(`request`)
+		ctx := tracefall.ContextWithLog(context.Background(), l)
+
+		Convey("Records are added to the Log and forwarded", func() {
+			logger := slog.New(NewHandler(next))
+
+			logger.InfoContext(ctx, `query`, `rows`, 2)
+			logger.DebugContext(ctx, `connect`)
+
+			notes := l.Notes().Get(DefaultNoteGroup).Notes
+			So(len(notes), ShouldEqual, 2)
+			So(notes[0].Note, ShouldEqual, `query`)
+			So(notes[0].Level, ShouldEqual, tracefall.LevelInfo)
+			So(notes[0].Attrs[`rows`], ShouldEqual, 2)
+			So(notes[1].Level, ShouldEqual, tracefall.LevelDebug)
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			So(len(lines), ShouldEqual, 1)
+			So(lines[0], ShouldContainSubstring, `"msg":"query"`)
+		})
+
+		Convey("Record without Log in context is only forwarded", func() {
+			logger := slog.New(NewHandler(next))
+			logger.Info(`plain`)
+
+			So(len(l.Notes()), ShouldBeZeroValue)
+			So(buf.String(), ShouldContainSubstring, `"msg":"plain"`)
+		})
+
+		Convey("Attributes and groups", func() {
+			logger := slog.New(NewHandler(next, WithNoteGroup(`app`))).
+				With(`service`, `api`).
+				WithGroup(`req`).
+				With(`id`, 7)
+
+			logger.WarnContext(ctx, `slow`, slog.Group(`db`, `ms`, 1200))
+
+			note := l.Notes().Get(`app`).Notes[0]
+			So(note.Level, ShouldEqual, tracefall.LevelWarn)
+			So(note.Attrs, ShouldResemble, map[string]interface{}{
+				`service`:   `api`,
+				`req.id`:    int64(7),
+				`req.db.ms`: int64(1200),
+			})
+			So(buf.String(), ShouldContainSubstring, `"req":{"id":7,"db":{"ms":1200}}`)
+		})
+
+		Convey("Error level", func() {
+			logger := slog.New(NewHandler(nil))
+			logger.ErrorContext(ctx, `failed`, `err`, errors.New(`timeout`))
+
+			note := l.Notes().Get(DefaultNoteGroup).Notes[0]
+			So(note.Level, ShouldEqual, tracefall.LevelError)
+			So(note.Error, ShouldEqual, `timeout`)
+			So(note.Attrs[`err`], ShouldEqual, `timeout`)
+			So(l.Error, ShouldBeNil)
+
+			Convey("marks the Log failed", func() {
+				logger := slog.New(NewHandler(nil, WithFailOnError()))
+				logger.ErrorContext(ctx, `failed`, `err`, errors.New(`timeout`))
+				So(l.Result, ShouldBeFalse)
+				So(l.Error.Error(), ShouldEqual, `timeout`)
+
+				logger.ErrorContext(ctx, `without error`)
+				So(l.Error.Error(), ShouldEqual, `without error`)
+			})
+		})
+
+		Convey("Level and source", func() {
+			h := NewHandler(nil, WithLevel(slog.LevelWarn), WithSource())
+			So(h.Enabled(ctx, slog.LevelInfo), ShouldBeFalse)
+			So(h.Enabled(ctx, slog.LevelWarn), ShouldBeTrue)
+			So(h.Enabled(context.Background(), slog.LevelError), ShouldBeFalse)
+
+			logger := slog.New(h)
+			logger.InfoContext(ctx, `skipped`)
+			logger.WarnContext(ctx, `kept`)
+
+			notes := l.Notes().Get(DefaultNoteGroup).Notes
+			So(len(notes), ShouldEqual, 1)
+			So(notes[0].Source, ShouldContainSubstring, `/handler_test.go:`)
+		})
+	})
+}
+
+func TestLevel(t *testing.T) {
+
+	Convey("Level mapping", t, func() {
+		So(Level(slog.LevelDebug-4), ShouldEqual, tracefall.LevelDebug)
+		So(Level(slog.LevelInfo), ShouldEqual, tracefall.LevelInfo)
+		So(Level(slog.LevelInfo+2), ShouldEqual, tracefall.LevelInfo)
+		So(Level(slog.LevelWarn), ShouldEqual, tracefall.LevelWarn)
+		So(Level(slog.LevelError+4), ShouldEqual, tracefall.LevelError)
+	})
+}
@@ -0,0 +1,232 @@
+package tracezap
+
+import (
+	"context"
+	"errors"
+
+	"github.com/efureev/tracefall"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Fields which are added to application log lines for cross-linking with the Log.
+// They are namespaced, so they do not clash with fields of the application
+const (
+	FieldThread = `tracefall.thread`
+	FieldID     = `tracefall.id`
+)
+
+// DefaultNoteGroup is label of the note group which entries are added to
+const DefaultNoteGroup = `log`
+
+const logFieldKey = `tracefall.log`
+
+// Option configures core
+type Option func(*config)
+
+type config struct {
+	group       string
+	level       zapcore.LevelEnabler
+	dataFields  map[string]bool
+	failOnError bool
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		group:      DefaultNoteGroup,
+		level:      zapcore.DebugLevel,
+		dataFields: map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithNoteGroup set label of the note group for entries
+func WithNoteGroup(label string) Option {
+	return func(c *config) {
+		c.group = label
+	}
+}
+
+// WithLevel set minimal level of entries which are added to the Log as notes
+func WithLevel(level zapcore.LevelEnabler) Option {
+	return func(c *config) {
+		c.level = level
+	}
+}
+
+// WithDataFields set keys of fields which are put to Log.Data instead of note attributes
+func WithDataFields(keys ...string) Option {
+	return func(c *config) {
+		for _, key := range keys {
+			c.dataFields[key] = true
+		}
+	}
+}
+
+// WithFailOnError mark the Log failed on entries with Error level and above
+func WithFailOnError() Option {
+	return func(c *config) {
+		c.failOnError = true
+	}
+}
+
+// Log return field which binds entry (or logger, when passed to With) to the Log.
+// The field is encoded inline as thread and id fields of the Log
+func Log(l *tracefall.Log) zap.Field {
+	if l == nil {
+		return zap.Skip()
+	}
+	return zap.Field{Key: logFieldKey, Type: zapcore.InlineMarshalerType, Interface: logMarshaler{l}}
+}
+
+// logMarshaler encode thread and id fields of the Log
+type logMarshaler struct {
+	log *tracefall.Log
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (m logMarshaler) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	shadow := m.log.ToShadow()
+	enc.AddString(FieldThread, shadow.Thread.String())
+	enc.AddString(FieldID, shadow.ID.String())
+	return nil
+}
+
+// Context return field which binds entry to the Log from context
+func Context(ctx context.Context) zap.Field {
+	return Log(tracefall.LogFromContext(ctx))
+}
+
+type core struct {
+	next   zapcore.Core
+	cfg    *config
+	log    *tracefall.Log
+	fields []zapcore.Field
+}
+
+// NewCore wrap core: entries bound to a Log (see Log and Context) are added to it as notes.
+// The next core checks and writes entries itself, so its sampling and filtering are kept
+func NewCore(next zapcore.Core, opts ...Option) zapcore.Core {
+	return &core{next: next, cfg: newConfig(opts)}
+}
+
+// Enabled implements zapcore.LevelEnabler
+func (c *core) Enabled(level zapcore.Level) bool {
+	return c.cfg.level.Enabled(level) || c.next.Enabled(level)
+}
+
+// With return core with fields which are added to every entry
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	l, rest := extractLog(fields)
+
+	clone := &core{
+		next:   c.next,
+		cfg:    c.cfg,
+		log:    c.log,
+		fields: append(append([]zapcore.Field{}, c.fields...), rest...),
+	}
+	if l != nil {
+		clone.log = l
+	}
+	clone.next = c.next.With(fields)
+	return clone
+}
+
+// Check implements zapcore.Core. The next core adds itself to the checked entry, then the core is added
+func (c *core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	ce = c.next.Check(ent, ce)
+	if c.cfg.level.Enabled(ent.Level) {
+		ce = ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write add the entry to the Log. The entry is written by the next core, which is added by Check
+func (c *core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	l, rest := extractLog(fields)
+
+	if target := c.target(l); target != nil {
+		c.addNote(target, ent, append(append([]zapcore.Field{}, c.fields...), rest...))
+	}
+	return nil
+}
+
+// Sync implements zapcore.Core
+func (c *core) Sync() error {
+	return c.next.Sync()
+}
+
+func (c *core) target(l *tracefall.Log) *tracefall.Log {
+	if l != nil {
+		return l
+	}
+	return c.log
+}
+
+func (c *core) addNote(l *tracefall.Log, ent zapcore.Entry, fields []zapcore.Field) {
+	var err error
+
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		if e, ok := f.Interface.(error); ok && f.Type == zapcore.ErrorType && err == nil {
+			err = e
+		}
+		f.AddTo(enc)
+	}
+
+	var attrs []tracefall.Attr
+	for key, value := range enc.Fields {
+		if c.cfg.dataFields[key] {
+			l.SetData(key, value)
+			continue
+		}
+		attrs = append(attrs, tracefall.NewAttr(key, value))
+	}
+
+	note := tracefall.NewLevelNote(Level(ent.Level), ent.Message, attrs...).SetError(err)
+	note.Time = ent.Time.UnixNano()
+	if ent.Caller.Defined {
+		note.Source = ent.Caller.TrimmedPath()
+	}
+
+	l.AddNote(c.cfg.group, note)
+
+	if c.cfg.failOnError && ent.Level >= zapcore.ErrorLevel {
+		if err == nil {
+			err = errors.New(ent.Message)
+		}
+		l.Fail(err)
+	}
+}
+
+// Level convert zap level to note level
+func Level(level zapcore.Level) tracefall.NoteLevel {
+	switch {
+	case level < zapcore.InfoLevel:
+		return tracefall.LevelDebug
+	case level < zapcore.WarnLevel:
+		return tracefall.LevelInfo
+	case level < zapcore.ErrorLevel:
+		return tracefall.LevelWarn
+	default:
+		return tracefall.LevelError
+	}
+}
+
+func extractLog(fields []zapcore.Field) (*tracefall.Log, []zapcore.Field) {
+	var l *tracefall.Log
+	rest := make([]zapcore.Field, 0, len(fields))
+	for _, f := range fields {
+		if f.Key == logFieldKey && f.Type == zapcore.InlineMarshalerType {
+			if m, ok := f.Interface.(logMarshaler); ok {
+				l = m.log
+				continue
+			}
+		}
+		rest = append(rest, f)
+	}
+	return l, rest
+}
@@ -0,0 +1,124 @@
+package tracezap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/efureev/tracefall"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestCore(t *testing.T) {
+
+	Convey("zap Core", t, func() {
+		next, logs := observer.New(zapcore.InfoLevel)
+
+		l := tracefall.NewLog(`request`)
+		ctx := tracefall.ContextWithLog(context.Background(), l)
+
+		Convey("Entries are added to the Log and enriched", func() {
+			logger := zap.New(NewCore(next))
+
+			logger.Info(`query`, Context(ctx), zap.Int(`rows`, 2))
+			logger.Debug(`connect`, Log(l))
+
+			notes := l.Notes().Get(DefaultNoteGroup).Notes
+			So(len(notes), ShouldEqual, 2)
+			So(notes[0].Note, ShouldEqual, `query`)
+			So(notes[0].Level, ShouldEqual, tracefall.LevelInfo)
+			So(notes[0].Attrs, ShouldResemble, map[string]interface{}{`rows`: int64(2)})
+			So(notes[1].Level, ShouldEqual, tracefall.LevelDebug)
+
+			entries := logs.All()
+			So(len(entries), ShouldEqual, 1)
+			So(entries[0].ContextMap(), ShouldResemble, map[string]interface{}{
+				`rows`:      int64(2),
+				FieldThread: l.Thread.String(),
+				FieldID:     l.ID.String(),
+			})
+		})
+
+		Convey("Entry without Log is only passed", func() {
+			logger := zap.New(NewCore(next))
+			logger.Info(`plain`, Context(context.Background()))
+
+			So(len(l.Notes()), ShouldBeZeroValue)
+			So(logs.All()[0].ContextMap(), ShouldBeEmpty)
+		})
+
+		Convey("Log bound by With", func() {
+			logger := zap.New(NewCore(next, WithNoteGroup(`app`), WithDataFields(`user`), WithLevel(zapcore.WarnLevel)), zap.AddCaller()).
+				With(Log(l), zap.String(`service`, `api`))
+
+			logger.Info(`skipped`)
+			logger.Warn(`slow`, zap.Int(`ms`, 1200), zap.String(`user`, `bob`))
+
+			notes := l.Notes().Get(`app`).Notes
+			So(len(notes), ShouldEqual, 1)
+			So(notes[0].Attrs, ShouldResemble, map[string]interface{}{`service`: `api`, `ms`: int64(1200)})
+			So(notes[0].Source, ShouldContainSubstring, `tracezap/core_test.go:`)
+			So(l.Data().Get(`user`), ShouldEqual, `bob`)
+
+			entries := logs.All()
+			So(len(entries), ShouldEqual, 2)
+			So(entries[1].ContextMap()[FieldID], ShouldEqual, l.ID.String())
+			So(entries[1].ContextMap()[`service`], ShouldEqual, `api`)
+		})
+
+		Convey("Sampling of the next core is kept", func() {
+			sampled := zapcore.NewSamplerWithOptions(next, time.Minute, 1, 0)
+			logger := zap.New(NewCore(sampled))
+
+			for i := 0; i < 3; i++ {
+				logger.Info(`repeated`, Log(l))
+			}
+
+			So(len(l.Notes().Get(DefaultNoteGroup).Notes), ShouldEqual, 3)
+			So(logs.Len(), ShouldEqual, 1)
+		})
+
+		Convey("Log field is encoded without the core", func() {
+			zap.New(next).Info(`plain core`, Log(l))
+
+			So(logs.All()[0].ContextMap(), ShouldResemble, map[string]interface{}{
+				FieldThread: l.Thread.String(),
+				FieldID:     l.ID.String(),
+			})
+			So(len(l.Notes()), ShouldBeZeroValue)
+		})
+
+		Convey("Error level", func() {
+			logger := zap.New(NewCore(next))
+			logger.Error(`failed`, Log(l), zap.Error(errors.New(`timeout`)))
+
+			note := l.Notes().Get(DefaultNoteGroup).Notes[0]
+			So(note.Level, ShouldEqual, tracefall.LevelError)
+			So(note.Error, ShouldEqual, `timeout`)
+			So(note.Attrs[`error`], ShouldEqual, `timeout`)
+			So(l.Error, ShouldBeNil)
+
+			Convey("marks the Log failed", func() {
+				logger := zap.New(NewCore(next, WithFailOnError()))
+				logger.Error(`failed`, Log(l), zap.Error(errors.New(`timeout`)))
+				So(l.Result, ShouldBeFalse)
+				So(l.Error.Error(), ShouldEqual, `timeout`)
+			})
+		})
+	})
+}
+
+func TestLevel(t *testing.T) {
+
+	Convey("Level mapping", t, func() {
+		So(Level(zapcore.DebugLevel), ShouldEqual, tracefall.LevelDebug)
+		So(Level(zapcore.InfoLevel), ShouldEqual, tracefall.LevelInfo)
+		So(Level(zapcore.WarnLevel), ShouldEqual, tracefall.LevelWarn)
+		So(Level(zapcore.ErrorLevel), ShouldEqual, tracefall.LevelError)
+		So(Level(zapcore.FatalLevel), ShouldEqual, tracefall.LevelError)
+	})
+}
@@ -0,0 +1,286 @@
+package tracezerolog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/efureev/tracefall"
+	"github.com/rs/zerolog"
+)
+
+// Fields which are added to application log lines for cross-linking with the Log.
+// They are namespaced, so they do not clash with fields of the application
+const (
+	FieldThread = `tracefall.thread`
+	FieldID     = `tracefall.id`
+)
+
+// Events which are marked by the hook wait for the writer. The marks of events which are written to another output
+// (the adapter is not the writer of the logger) expire after pendingTTL, count of marked Logs is limited by pendingLimit
+const (
+	pendingTTL   = time.Minute
+	pendingLimit = 1024
+)
+
+var idPrefix = []byte(`"` + FieldID + `":"`)
+
+// DefaultNoteGroup is label of the note group which events are added to
+const DefaultNoteGroup = `log`
+
+// Option configures adapter
+type Option func(*config)
+
+type config struct {
+	group       string
+	level       zerolog.Level
+	dataFields  map[string]bool
+	failOnError bool
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		group:      DefaultNoteGroup,
+		level:      zerolog.DebugLevel,
+		dataFields: map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithNoteGroup set label of the note group for events
+func WithNoteGroup(label string) Option {
+	return func(c *config) {
+		c.group = label
+	}
+}
+
+// WithLevel set minimal level of events which are added to the Log as notes
+func WithLevel(level zerolog.Level) Option {
+	return func(c *config) {
+		c.level = level
+	}
+}
+
+// WithDataFields set keys of fields which are put to Log.Data instead of note attributes
+func WithDataFields(keys ...string) Option {
+	return func(c *config) {
+		for _, key := range keys {
+			c.dataFields[key] = true
+		}
+	}
+}
+
+// WithFailOnError mark the Log failed on events with Error level and above
+func WithFailOnError() Option {
+	return func(c *config) {
+		c.failOnError = true
+	}
+}
+
+// Adapter is zerolog hook and writer at once. As hook it adds thread and id fields of the Log
+// from the event context (see zerolog.Event.Ctx), as writer it copies written events of the Log into notes
+// and passes them to the next writer. Only lines of the marked events are parsed.
+// The adapter must be both the hook and the output of a logger:
+//
+//	a := tracezerolog.New(os.Stdout)
+//	logger := zerolog.New(a).Hook(a)
+//	logger.Info().Ctx(ctx).Int(`rows`, 2).Msg(`query`)
+type Adapter struct {
+	next io.Writer
+	cfg  *config
+
+	mu      sync.Mutex
+	pending map[string]*pendingLog
+	purgeAt time.Time
+	now     func() time.Time
+}
+
+// pendingLog is Log of the events which were marked by the hook and are not written yet
+type pendingLog struct {
+	log     *tracefall.Log
+	count   int
+	expires time.Time
+}
+
+// New create new Adapter. The next writer may be nil: events are only added to the Log then
+func New(next io.Writer, opts ...Option) *Adapter {
+	return &Adapter{
+		next:    next,
+		cfg:     newConfig(opts),
+		pending: make(map[string]*pendingLog),
+		now:     time.Now,
+	}
+}
+
+// Run implements zerolog.Hook
+func (a *Adapter) Run(e *zerolog.Event, level zerolog.Level, _ string) {
+	l := tracefall.LogFromContext(e.GetCtx())
+	if l == nil {
+		return
+	}
+
+	shadow := l.ToShadow()
+	id := shadow.ID.String()
+	e.Str(FieldThread, shadow.Thread.String()).Str(FieldID, id)
+
+	if level < a.cfg.level {
+		return
+	}
+	a.mark(id, l)
+}
+
+// mark the event of the Log, so the writer adds it to the Log
+func (a *Adapter) mark(id string, l *tracefall.Log) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	if len(a.pending) >= pendingLimit || now.After(a.purgeAt) {
+		a.purge(now)
+	}
+
+	p, ok := a.pending[id]
+	if !ok {
+		if len(a.pending) >= pendingLimit {
+			return
+		}
+		p = &pendingLog{log: l}
+		a.pending[id] = p
+	}
+	p.count++
+	p.expires = now.Add(pendingTTL)
+}
+
+// purge remove expired marks
+func (a *Adapter) purge(now time.Time) {
+	for id, p := range a.pending {
+		if now.After(p.expires) {
+			delete(a.pending, id)
+		}
+	}
+	a.purgeAt = now.Add(pendingTTL)
+}
+
+// Write implements io.Writer
+func (a *Adapter) Write(p []byte) (int, error) {
+	a.handle(p)
+	if a.next == nil {
+		return len(p), nil
+	}
+	return a.next.Write(p)
+}
+
+// WriteLevel implements zerolog.LevelWriter
+func (a *Adapter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	a.handle(p)
+	if a.next == nil {
+		return len(p), nil
+	}
+	if lw, ok := a.next.(zerolog.LevelWriter); ok {
+		return lw.WriteLevel(level, p)
+	}
+	return a.next.Write(p)
+}
+
+func (a *Adapter) take(id string) *tracefall.Log {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	p, ok := a.pending[id]
+	if !ok {
+		return nil
+	}
+	p.count--
+	if p.count <= 0 {
+		delete(a.pending, id)
+	}
+	return p.log
+}
+
+// lineID return value of FieldID of the line without parsing of the whole line
+func lineID(p []byte) string {
+	i := bytes.Index(p, idPrefix)
+	if i < 0 {
+		return ``
+	}
+	rest := p[i+len(idPrefix):]
+	j := bytes.IndexByte(rest, '"')
+	if j < 0 {
+		return ``
+	}
+	return string(rest[:j])
+}
+
+func (a *Adapter) handle(p []byte) {
+	id := lineID(p)
+	if id == `` {
+		return
+	}
+	l := a.take(id)
+	if l == nil {
+		return
+	}
+
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return
+	}
+
+	msg, _ := fields[zerolog.MessageFieldName].(string)
+	levelName, _ := fields[zerolog.LevelFieldName].(string)
+	level, _ := zerolog.ParseLevel(levelName)
+	note := tracefall.NewLevelNote(Level(level), msg)
+
+	var err error
+	if errText, ok := fields[zerolog.ErrorFieldName].(string); ok {
+		err = errors.New(errText)
+		note.SetError(err)
+	}
+	if caller, ok := fields[zerolog.CallerFieldName].(string); ok {
+		note.Source = caller
+	}
+
+	for _, key := range []string{FieldThread, FieldID, zerolog.MessageFieldName, zerolog.LevelFieldName,
+		zerolog.TimestampFieldName, zerolog.CallerFieldName} {
+		delete(fields, key)
+	}
+
+	for key, value := range fields {
+		if a.cfg.dataFields[key] {
+			l.SetData(key, value)
+			continue
+		}
+		note.AddAttrs(tracefall.NewAttr(key, value))
+	}
+
+	l.AddNote(a.cfg.group, note)
+
+	if a.cfg.failOnError && level >= zerolog.ErrorLevel && level < zerolog.NoLevel {
+		if err == nil {
+			err = errors.New(msg)
+		}
+		l.Fail(err)
+	}
+}
+
+// Level convert zerolog level to note level
+func Level(level zerolog.Level) tracefall.NoteLevel {
+	switch {
+	case level < zerolog.InfoLevel:
+		return tracefall.LevelDebug
+	case level < zerolog.WarnLevel, level >= zerolog.NoLevel:
+		return tracefall.LevelInfo
+	case level < zerolog.ErrorLevel:
+		return tracefall.LevelWarn
+	default:
+		return tracefall.LevelError
+	}
+}
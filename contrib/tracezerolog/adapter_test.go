@@ -0,0 +1,151 @@
+package tracezerolog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efureev/tracefall"
+	"github.com/rs/zerolog"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAdapter(t *testing.T) {
+
+	Convey("zerolog Adapter", t, func() {
+		var buf bytes.Buffer
+
+		l := tracefall.NewLog(`request`)
+		ctx := tracefall.ContextWithLog(context.Background(), l)
+
+		lines := func() []map[string]interface{} {
+			var list []map[string]interface{}
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				var fields map[string]interface{}
+				So(json.Unmarshal([]byte(line), &fields), ShouldBeNil)
+				list = append(list, fields)
+			}
+			return list
+		}
+
+		Convey("Events are added to the Log and enriched", func() {
+			a := New(&buf)
+			logger := zerolog.New(a).Hook(a)
+
+			logger.Info().Ctx(ctx).Int(`rows`, 2).Msg(`query`)
+			logger.Debug().Ctx(ctx).Msg(`connect`)
+
+			notes := l.Notes().Get(DefaultNoteGroup).Notes
+			So(len(notes), ShouldEqual, 2)
+			So(notes[0].Note, ShouldEqual, `query`)
+			So(notes[0].Level, ShouldEqual, tracefall.LevelInfo)
+			So(notes[0].Attrs, ShouldResemble, map[string]interface{}{`rows`: json.Number(`2`)})
+			So(notes[1].Level, ShouldEqual, tracefall.LevelDebug)
+
+			list := lines()
+			So(len(list), ShouldEqual, 2)
+			So(list[0][FieldThread], ShouldEqual, l.Thread.String())
+			So(list[0][FieldID], ShouldEqual, l.ID.String())
+			So(list[0][`rows`], ShouldEqual, 2)
+
+			So(a.pending, ShouldBeEmpty)
+		})
+
+		Convey("Event without Log is only written", func() {
+			a := New(&buf)
+			logger := zerolog.New(a).Hook(a)
+			logger.Info().Msg(`plain`)
+
+			So(len(l.Notes()), ShouldBeZeroValue)
+			So(lines()[0][FieldID], ShouldBeNil)
+		})
+
+		Convey("Options", func() {
+			a := New(&buf, WithNoteGroup(`app`), WithDataFields(`user`), WithLevel(zerolog.WarnLevel))
+			logger := zerolog.New(a).Hook(a).With().Ctx(ctx).Str(`service`, `api`).Caller().Logger()
+
+			logger.Info().Msg(`skipped`)
+			logger.Warn().Int(`ms`, 1200).Str(`user`, `bob`).Msg(`slow`)
+
+			notes := l.Notes().Get(`app`).Notes
+			So(len(notes), ShouldEqual, 1)
+			So(notes[0].Attrs, ShouldResemble, map[string]interface{}{`service`: `api`, `ms`: json.Number(`1200`)})
+			So(notes[0].Source, ShouldContainSubstring, `adapter_test.go:`)
+			So(l.Data().Get(`user`), ShouldEqual, `bob`)
+
+			So(len(lines()), ShouldEqual, 2)
+			So(a.pending, ShouldBeEmpty)
+		})
+
+		Convey("Error level", func() {
+			a := New(nil)
+			logger := zerolog.New(a).Hook(a)
+			logger.Error().Ctx(ctx).Err(errors.New(`timeout`)).Msg(`failed`)
+
+			note := l.Notes().Get(DefaultNoteGroup).Notes[0]
+			So(note.Level, ShouldEqual, tracefall.LevelError)
+			So(note.Error, ShouldEqual, `timeout`)
+			So(l.Error, ShouldBeNil)
+
+			Convey("marks the Log failed", func() {
+				a := New(nil, WithFailOnError())
+				logger := zerolog.New(a).Hook(a)
+				logger.Error().Ctx(ctx).Msg(`failed`)
+				So(l.Result, ShouldBeFalse)
+				So(l.Error.Error(), ShouldEqual, `failed`)
+			})
+		})
+
+		Convey("Events which are written to other output expire", func() {
+			now := time.Now()
+			a := New(&buf)
+			a.now = func() time.Time { return now }
+
+			var other bytes.Buffer
+			logger := zerolog.New(&other).Hook(a)
+			logger.Info().Ctx(ctx).Msg(`elsewhere`)
+			So(a.pending, ShouldHaveLength, 1)
+			So(other.String(), ShouldContainSubstring, `"`+FieldID+`":"`+l.ID.String()+`"`)
+
+			other2 := tracefall.NewLog(`other`)
+			now = now.Add(pendingTTL + time.Second)
+			logger.Info().Ctx(tracefall.ContextWithLog(context.Background(), other2)).Msg(`elsewhere`)
+			So(a.pending, ShouldHaveLength, 1)
+			So(a.pending, ShouldContainKey, other2.ID.String())
+			So(len(l.Notes()), ShouldBeZeroValue)
+		})
+
+		Convey("Count of marked Logs is limited", func() {
+			a := New(&buf)
+			logger := zerolog.New(io.Discard).Hook(a)
+			for i := 0; i < pendingLimit+10; i++ {
+				logger.Info().Ctx(tracefall.ContextWithLog(context.Background(), tracefall.NewLog(`other`))).Msg(`elsewhere`)
+			}
+			So(a.pending, ShouldHaveLength, pendingLimit)
+		})
+
+		Convey("Line ID", func() {
+			So(lineID([]byte(`{"level":"info","`+FieldID+`":"abc","message":"m"}`)), ShouldEqual, `abc`)
+			So(lineID([]byte(`{"level":"info","id":"abc"}`)), ShouldBeEmpty)
+			So(lineID([]byte(`{"`+FieldID+`":"abc`)), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestLevel(t *testing.T) {
+
+	Convey("Level mapping", t, func() {
+		So(Level(zerolog.TraceLevel), ShouldEqual, tracefall.LevelDebug)
+		So(Level(zerolog.DebugLevel), ShouldEqual, tracefall.LevelDebug)
+		So(Level(zerolog.InfoLevel), ShouldEqual, tracefall.LevelInfo)
+		So(Level(zerolog.NoLevel), ShouldEqual, tracefall.LevelInfo)
+		So(Level(zerolog.WarnLevel), ShouldEqual, tracefall.LevelWarn)
+		So(Level(zerolog.ErrorLevel), ShouldEqual, tracefall.LevelError)
+		So(Level(zerolog.PanicLevel), ShouldEqual, tracefall.LevelError)
+	})
+}
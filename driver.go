@@ -3,6 +3,7 @@ package tracefall
 import (
 	"context"
 	"fmt"
+	"io"
 	"sort"
 	"sync"
 
@@ -58,14 +59,95 @@ func Drivers() []string {
 type DB struct {
 	connector Connector
 	stop      func() // stop cancels the connection opener and the session resetter.
+
+	mu         sync.RWMutex
+	redactor   *Redactor
+	tail       *tailSampler
+	processors processors
 }
 
 func (d *DB) conn(ctx context.Context) (interface{}, error) {
 	return d.connector.Connect(ctx)
 }
 
+// Send pass snapshot of the log to driver, so the log may be changed further while driver sends it.
+// Logs of threads which are dropped by head sampling do not reach the driver. Sensitive values of the snapshot
+// are redacted when DB has Redactor, then processors are called: they may change, drop or reroute the snapshot.
+// Logs are buffered when DB has tail sampling (see SetTailSampling).
+// Successful response is returned for dropped and buffered logs
 func (d *DB) Send(log *Log) (ResponseCmd, error) {
-	return d.connector.Driver().Send(log)
+	log.sampling()
+	snap := log.Snapshot()
+	if !snap.Sampling.Sampled() {
+		return *NewResponse(snap).Success().ToCmd(), nil
+	}
+
+	d.mu.RLock()
+	r, tail, list := d.redactor, d.tail, d.processors
+	d.mu.RUnlock()
+
+	if r != nil {
+		r.apply(snap)
+	}
+
+	e := &SendEvent{Log: snap, Driver: d.connector.Driver()}
+	getProcessors().onSend(e)
+	if !e.Drop {
+		list.onSend(e)
+	}
+	if e.Drop || e.Log == nil {
+		return *NewResponse(snap).Success().ToCmd(), nil
+	}
+	if e.Driver == nil {
+		e.Driver = d.connector.Driver()
+	}
+
+	if tail != nil {
+		return tail.send(e)
+	}
+	return e.Driver.Send(e.Log)
+}
+
+// AddProcessor add processor of DB. Only OnSend is called for processors of DB
+func (d *DB) AddProcessor(p Processor) *DB {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.processors = d.processors.add(p)
+	return d
+}
+
+// SetTailSampling turn on tail sampling of threads by the policy. Nil turns it off.
+// Buffered logs of the previous policy are dropped
+func (d *DB) SetTailSampling(policy *TailPolicy) *DB {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.tail != nil {
+		d.tail.stop()
+		d.tail = nil
+	}
+	if policy != nil {
+		d.tail = newTailSampler(*policy)
+	}
+	return d
+}
+
+// SetRedactor set Redactor which is applied to logs before sending. Nil turns redaction off
+func (d *DB) SetRedactor(r *Redactor) *DB {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.redactor = r
+	return d
+}
+
+// Redactor return Redactor of DB
+func (d *DB) Redactor() *Redactor {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.redactor
 }
 
 func (d *DB) RemoveThread(id uuid.UUID) (ResponseCmd, error) {
@@ -92,11 +174,35 @@ func (d *DB) Driver() Driver {
 	return d.connector.Driver()
 }
 
+// Close stop tail sampling (buffered logs are dropped) and close the driver if it implements io.Closer
+func (d *DB) Close() error {
+	d.stop()
+
+	d.mu.Lock()
+	if d.tail != nil {
+		d.tail.stop()
+		d.tail = nil
+	}
+	d.mu.Unlock()
+
+	if c, ok := d.connector.Driver().(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Connector open connection of the driver. Drivers may provide their own connectors, see OpenDB
 type Connector interface {
 	Connect(ctx context.Context) (interface{}, error)
 	Driver() Driver
 }
 
+// DriverContext is optional interface of Driver. Open uses its connector, so every DB has own instance of the driver
+// and the registered driver keeps no state of connections
+type DriverContext interface {
+	OpenConnector(params map[string]string) (Connector, error)
+}
+
 type drvConnector struct {
 	params map[string]string
 	driver Driver
@@ -118,6 +224,14 @@ func Open(driverName string, connectParams map[string]string) (*DB, error) {
 		return nil, fmt.Errorf("tracer: unknown driver %q (forgotten import?)", driverName)
 	}
 
+	if dc, ok := driveri.(DriverContext); ok {
+		c, err := dc.OpenConnector(connectParams)
+		if err != nil {
+			return nil, err
+		}
+		return OpenDB(c)
+	}
+
 	db, err := OpenDB(drvConnector{params: connectParams, driver: driveri})
 	if err != nil {
 		return db, err
@@ -125,7 +239,8 @@ func Open(driverName string, connectParams map[string]string) (*DB, error) {
 	return db, nil
 }
 
-func OpenDB(c drvConnector) (*DB, error) {
+// OpenDB open DB by the connector: drivers use it to open DB with an existing connection of the caller
+func OpenDB(c Connector) (*DB, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	db := &DB{
 		connector: c,
@@ -2,6 +2,7 @@ package tracefall
 
 import (
 	"errors"
+	"sync"
 	"testing"
 
 	uuid "github.com/satori/go.uuid"
@@ -42,6 +43,54 @@ func (d DriverTest) Open(map[string]string) (interface{}, error) {
 	return nil, nil
 }
 
+// recordDriver records sent logs. Contrib packages use internal/tracetest, which can not be imported here
+type recordDriver struct {
+	DriverTest
+
+	mu     sync.Mutex
+	logs   []*Log
+	closed bool
+}
+
+func (d *recordDriver) Send(l *Log) (ResponseCmd, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.logs = append(d.logs, l)
+	return *NewResponse(l).Success().ToCmd(), nil
+}
+
+func (d *recordDriver) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	return nil
+}
+
+func (d *recordDriver) names() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var list []string
+	for _, l := range d.logs {
+		list = append(list, l.Name)
+	}
+	return list
+}
+
+// connectorDriver opens every DB with new instance of the driver
+type connectorDriver struct {
+	DriverTest
+}
+
+func (d connectorDriver) OpenConnector(params map[string]string) (Connector, error) {
+	if params[`fail`] != `` {
+		return nil, errors.New(`invalid params`)
+	}
+	return drvConnector{params: params, driver: &recordDriver{}}, nil
+}
+
 func TestDriver(t *testing.T) {
 
 	Convey("Driver Register", t, func() {
@@ -80,6 +129,17 @@ func TestDriver(t *testing.T) {
 				So(r.Request(), ShouldEqual, l.String())
 			})
 
+			Convey("Send with Redactor", func() {
+				db.SetRedactor(NewRedactor().Pattern(PatternEmail))
+				defer db.SetRedactor(nil)
+
+				l := NewLog(`send to bob@example.com`)
+				r, err := db.Send(l)
+				So(err, ShouldBeNil)
+				So(r.Request(), ShouldEndWith, `send to `+DefaultRedactMask)
+				So(l.Name, ShouldEqual, `send to bob@example.com`)
+			})
+
 			Convey("Get", func() {
 				id := generateUUID()
 				r, _ := db.GetLog(id)
@@ -149,4 +209,40 @@ func TestDriver(t *testing.T) {
 		unregisterAllDrivers()
 	})
 
+	Convey("Driver with connector", t, func() {
+		Register("connector", connectorDriver{})
+		defer unregisterAllDrivers()
+
+		db1, err := Open(`connector`, map[string]string{})
+		So(err, ShouldBeNil)
+		db2, err := Open(`connector`, map[string]string{})
+		So(err, ShouldBeNil)
+
+		So(db1.Driver(), ShouldHaveSameTypeAs, &recordDriver{})
+		So(db1.Driver(), ShouldNotPointTo, db2.Driver())
+
+		_, err = db1.Send(NewLog(`first`))
+		So(err, ShouldBeNil)
+		So(db1.Driver().(*recordDriver).names(), ShouldResemble, []string{`first`})
+		So(db2.Driver().(*recordDriver).names(), ShouldBeEmpty)
+
+		_, err = Open(`connector`, map[string]string{`fail`: `1`})
+		So(err, ShouldBeError)
+
+		Convey("Close", func() {
+			db1.SetTailSampling(&TailPolicy{KeepFailed: true})
+			_, err = db1.Send(NewLog(`buffered`))
+			So(err, ShouldBeNil)
+
+			So(db1.Close(), ShouldBeNil)
+			So(db1.Driver().(*recordDriver).closed, ShouldBeTrue)
+			So(db2.Driver().(*recordDriver).closed, ShouldBeFalse)
+			So(db1.tail, ShouldBeNil)
+			So(db1.Driver().(*recordDriver).names(), ShouldResemble, []string{`first`})
+
+			db, err := OpenDB(drvConnector{driver: &DriverTest{}})
+			So(err, ShouldBeNil)
+			So(db.Close(), ShouldBeNil)
+		})
+	})
 }
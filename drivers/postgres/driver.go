@@ -1,9 +1,12 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/efureev/tracefall"
@@ -11,60 +14,132 @@ import (
 	uuid "github.com/satori/go.uuid"
 )
 
+// columns of the table which are read and written by the driver
+const columns = `"id", "thread", "parent", "app", "name", "time", "time_end", "env", "tags", "notes", "data", "error", "result", "finish", "resource", "duration", "status"`
+
 type Params struct {
 	Host, User, Password, DbName, TableName string
+	// DSN is connection string (param `dsn`): URL or `key=value` string. Discrete params override its values
+	DSN string
+	// Port of the server (param `port`). Host may have port too: `localhost:5432`
+	Port string
+	// SSLMode (param `sslmode`) is `disable` by default when DSN is not set. Certificates are paths
+	// (params `sslcert`, `sslkey`, `sslrootcert`)
+	SSLMode, SSLCert, SSLKey, SSLRootCert string
+	// ApplicationName of connections (param `application_name`)
+	ApplicationName string
+	// SearchPath of connections (param `search_path`): schemas of unqualified names
+	SearchPath string
+	// ConnectTimeout (param `connect_timeout`) and StatementTimeout (param `statement_timeout`) are durations: `5s`
+	ConnectTimeout, StatementTimeout time.Duration
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime set the pool of the driver (params `max_open_conns`,
+	// `max_idle_conns`, `conn_max_lifetime`). They are not applied to the pool of the caller (see OpenDB)
+	MaxOpenConns, MaxIdleConns int
+	ConnMaxLifetime            time.Duration
+
+	// Migrate apply migrations on Open. It is turned off by param `migrate`: `false`
+	Migrate bool
+
+	// Partition is partitioning of new table by time (param `partition`): daily, weekly or none
+	Partition Partitioning
+	// PartitionsAhead is count of partitions which are created ahead (param `partitions_ahead`)
+	PartitionsAhead int
+	// RetentionDays is age of logs which are removed by Maintain (param `retention`). Zero keeps logs forever
+	RetentionDays int
+	// RemoveBatch is count of rows which are removed by one statement of RemoveOlderThan (param `batch`)
+	RemoveBatch int
+
+	// Layout of notes and tags of new table (param `layout`): denormalized or normalized
+	Layout Layout
 }
 
-func (p *Params) set(params map[string]string) {
+func (p *Params) set(params map[string]string) error {
 	p.Host = params[`host`]
 	p.User = params[`user`]
 	p.Password = params[`pwd`]
 	p.DbName = params[`db`]
 	p.TableName = params[`table`]
-}
+	p.DSN = params[`dsn`]
+	p.Port = params[`port`]
+	p.SSLMode = params[`sslmode`]
+	p.SSLCert = params[`sslcert`]
+	p.SSLKey = params[`sslkey`]
+	p.SSLRootCert = params[`sslrootcert`]
+	p.ApplicationName = params[`application_name`]
+	p.SearchPath = params[`search_path`]
+	p.Migrate = params[`migrate`] != `false`
+
+	if _, err := parseIdentifier(p.TableName); err != nil {
+		return err
+	}
 
-type DriverPostgres struct {
-	params Params
-}
+	p.Partition = Partitioning(params[`partition`])
+	switch p.Partition {
+	case PartitionNone, PartitionDaily, PartitionWeekly:
+	default:
+		return fmt.Errorf(`unknown partitioning: %s`, p.Partition)
+	}
 
-func (d *DriverPostgres) initDb() *sql.DB {
-	db, err := sql.Open("postgres", d.params.pgConnectionStr())
-	if err != nil {
-		panic(err)
+	var err error
+	if p.Layout, err = layoutParam(params); err != nil {
+		return err
+	}
+	if p.PartitionsAhead, err = intParam(params, `partitions_ahead`, DefaultPartitionsAhead); err != nil {
+		return err
+	}
+	if p.RetentionDays, err = intParam(params, `retention`, 0); err != nil {
+		return err
+	}
+	if p.RemoveBatch, err = intParam(params, `batch`, DefaultRemoveBatch); err != nil {
+		return err
+	}
+	if p.MaxOpenConns, err = intParam(params, `max_open_conns`, 0); err != nil {
+		return err
+	}
+	if p.MaxIdleConns, err = intParam(params, `max_idle_conns`, 0); err != nil {
+		return err
+	}
+	if p.ConnectTimeout, err = durationParam(params, `connect_timeout`); err != nil {
+		return err
+	}
+	if p.StatementTimeout, err = durationParam(params, `statement_timeout`); err != nil {
+		return err
+	}
+	if p.ConnMaxLifetime, err = durationParam(params, `conn_max_lifetime`); err != nil {
+		return err
 	}
+	return nil
+}
 
-	return db
+func intParam(params map[string]string, key string, def int) (int, error) {
+	val, ok := params[key]
+	if !ok || val == `` {
+		return def, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf(`invalid param %s: %s`, key, val)
+	}
+	return n, nil
 }
 
-func (p Params) pgConnectionStr() string {
-	return fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable",
-		p.User,
-		p.Password,
-		p.Host,
-		p.DbName,
-	)
+type DriverPostgres struct {
+	params Params
+	// db is pool of connections which is shared by queries
+	db *sql.DB
+	// external is true when the pool is owned by the caller, see OpenDB
+	external bool
 }
 
 func (d DriverPostgres) Send(l *tracefall.Log) (tracefall.ResponseCmd, error) {
-	db := d.initDb()
-	defer db.Close()
-
-	query := `INSERT INTO "` + d.params.TableName + `" (
-			"id", "thread", "parent", "app", "name", "time", "time_end", "env", "tags", "notes", "data", "error", "result", "finish"
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING "id";`
+	query := `INSERT INTO ` + d.table().quoted() + ` (` + columns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING "id";`
 
 	resp := tracefall.NewResponse(l)
 
-	stmt, err := db.Prepare(query)
-
-	if err != nil {
-		return *resp.SetError(err).ToCmd(), err
-	}
-	defer stmt.Close()
-
 	var (
-		parentID, errLog *string
-		te               *int64
+		parentID *string
+		te, dur  *int64
 	)
 
 	if l.Parent != nil {
@@ -74,42 +149,52 @@ func (d DriverPostgres) Send(l *tracefall.Log) (tracefall.ResponseCmd, error) {
 		parentID = nil
 	}
 
-	if l.Error != nil {
-		errStr := l.Error.Error()
-		errLog = &errStr
-	} else {
-		errLog = nil
-	}
-
 	if l.TimeEnd != nil {
 		teInt := l.TimeEnd.UnixNano()
 		te = &teInt
+		durInt := l.Duration().Nanoseconds()
+		dur = &durInt
 	}
 
-	row := db.QueryRow(query, l.ID.String(), l.Thread.String(), parentID, l.App, l.Name, l.Time.UnixNano(), te,
-		l.Environment, pq.Array(l.Tags), l.Notes.ToJSON(), l.Data.ToJSON(), errLog, l.Result, l.Finish)
+	resource, err := resourceToJSON(l.Resource)
+	if err != nil {
+		return *resp.SetError(err).ToCmd(), err
+	}
 
-	var id string
+	errLog, err := errorToJSON(l.GetErrorInfo())
+	if err != nil {
+		return *resp.SetError(err).ToCmd(), err
+	}
 
-	switch err := row.Scan(&id); err {
-	case sql.ErrNoRows:
+	var tags, notes interface{} = pq.Array(l.Tags().List()), l.Notes().ToJSON()
+	if d.params.Layout == LayoutNormalized {
+		tags, notes = nil, `[]`
+	}
+	args := []interface{}{l.ID.String(), l.Thread.String(), parentID, l.App, l.Name, l.Time.UnixNano(), te,
+		l.Environment, tags, notes, l.Data().ToJSON(), errLog, l.Result, l.Finish, resource, dur, l.GetStatus()}
+
+	if d.params.Layout == LayoutNormalized {
+		id, err := d.sendNormalized(query, l, args)
+		if err != nil {
+			return *resp.SetError(err).ToCmd(), err
+		}
+		return *resp.Success().SetID(id).ToCmd(), nil
+	}
+
+	row := d.conn().QueryRow(query, args...)
+
+	var id string
+	if err = row.Scan(&id); err != nil {
 		return *resp.SetError(err).ToCmd(), err
-	case nil:
-		return *resp.Success().SetID(id).ToCmd(), err
-	default:
-		panic(err)
 	}
+
+	return *resp.Success().SetID(id).ToCmd(), nil
 }
 
 func (d DriverPostgres) RemoveThread(id uuid.UUID) (tracefall.ResponseCmd, error) {
-	db := d.initDb()
-	defer db.Close()
-
-	query := `DELETE FROM "` + d.params.TableName + `" WHERE thread = $1`
-
 	resp := tracefall.NewResponse(id)
 
-	_, err := db.Exec(query, id.String())
+	_, err := d.remove(context.Background(), `"thread" = $1`, id.String())
 	if err != nil {
 		return *resp.SetError(err).ToCmd(), err
 	}
@@ -117,15 +202,15 @@ func (d DriverPostgres) RemoveThread(id uuid.UUID) (tracefall.ResponseCmd, error
 	return *resp.Success().ToCmd(), nil
 }
 
+// RemoveByTags remove logs which have all the tags. Return ErrorEmptyTags without tags
 func (d DriverPostgres) RemoveByTags(tags tracefall.Tags) (tracefall.ResponseCmd, error) {
-	db := d.initDb()
-	defer db.Close()
-
-	query := `DELETE FROM "` + d.params.TableName + `" WHERE $1 <@ "tags"`
-
 	resp := tracefall.NewResponse(tags)
 
-	_, err := db.Exec(query, pq.Array(tags))
+	if len(tags) == 0 {
+		return *resp.SetError(ErrorEmptyTags).ToCmd(), ErrorEmptyTags
+	}
+
+	_, err := d.remove(context.Background(), d.tagsCondition(`$1`), pq.Array(tags))
 	if err != nil {
 		return *resp.SetError(err).ToCmd(), err
 	}
@@ -134,58 +219,18 @@ func (d DriverPostgres) RemoveByTags(tags tracefall.Tags) (tracefall.ResponseCmd
 }
 
 func (d DriverPostgres) getListResult(rows *sql.Rows) ([]*tracefall.Log, error) {
-	var logList []*tracefall.Log
-
-	for rows.Next() {
-		var (
-			l                   = tracefall.Log{}
-			idStr, threadStr    string
-			parentPtr, errorPtr *string
-			notesStr, dataStr   []byte
-			ts                  int64
-			te                  *int64
-			t                   pq.StringArray
-		)
-		err := rows.Scan(&idStr, &threadStr, &parentPtr, &l.App, &l.Name, &ts, &te, &l.Environment, &t, &notesStr, &dataStr, &errorPtr, &l.Result, &l.Finish)
-		if err != nil {
-			return nil, err
-		}
+	list, err := d.getListLogJSONResult(rows)
+	if err != nil {
+		return nil, err
+	}
 
-		uid, err := uuid.FromString(idStr)
+	logList := make([]*tracefall.Log, 0, len(list))
+	for _, lj := range list {
+		l, err := lj.ToLog()
 		if err != nil {
 			return nil, err
 		}
-		l.ID = uid
-		thid, err := uuid.FromString(threadStr)
-		if err != nil {
-			return nil, err
-		}
-		l.Thread = thid
-
-		if parentPtr != nil {
-			pid, err := uuid.FromString(*parentPtr)
-			if err != nil {
-				return nil, err
-			}
-			l.SetParentID(pid)
-		}
-
-		l.Data.FromJSON(dataStr)
-		l.Notes.FromJSON(notesStr)
-		l.Tags = tracefall.Tags(t)
-
-		l.Time = time.Unix(0, ts)
-
-		if te != nil {
-			t := time.Unix(0, *te)
-			l.TimeEnd = &t
-		}
-
-		if errorPtr != nil {
-			l.Error = errors.New(*errorPtr)
-		}
-
-		logList = append(logList, &l)
+		logList = append(logList, l)
 	}
 
 	return logList, nil
@@ -196,15 +241,17 @@ func (d DriverPostgres) getListLogJSONResult(rows *sql.Rows) ([]*tracefall.LogJS
 
 	for rows.Next() {
 		var (
-			l                   = tracefall.LogJSON{}
-			idStr, threadStr    string
-			parentPtr, errorPtr *string
-			notesStr, dataStr   []byte
-			ts                  int64
-			te                  *int64
-			t                   pq.StringArray
+			l                 = tracefall.LogJSON{}
+			idStr, threadStr  string
+			parentPtr         *string
+			notesStr, dataStr []byte
+			errorStr          []byte
+			resourceStr       []byte
+			ts                int64
+			te                *int64
+			t                 pq.StringArray
 		)
-		err := rows.Scan(&idStr, &threadStr, &parentPtr, &l.App, &l.Name, &ts, &te, &l.Environment, &t, &notesStr, &dataStr, &errorPtr, &l.Result, &l.Finish)
+		err := rows.Scan(&idStr, &threadStr, &parentPtr, &l.App, &l.Name, &ts, &te, &l.Environment, &t, &notesStr, &dataStr, &errorStr, &l.Result, &l.Finish, &resourceStr, &l.Duration, &l.Status)
 		if err != nil {
 			return nil, err
 		}
@@ -228,7 +275,13 @@ func (d DriverPostgres) getListLogJSONResult(rows *sql.Rows) ([]*tracefall.LogJS
 
 		l.Time = ts
 		l.TimeEnd = te
-		l.Error = errorPtr
+
+		if l.Error, err = errorFromJSON(errorStr); err != nil {
+			return nil, err
+		}
+		if l.Resource, err = resourceFromJSON(resourceStr); err != nil {
+			return nil, err
+		}
 
 		list = append(list, &l)
 	}
@@ -237,10 +290,9 @@ func (d DriverPostgres) getListLogJSONResult(rows *sql.Rows) ([]*tracefall.LogJS
 }
 
 func (d DriverPostgres) getListByThread(id uuid.UUID) ([]*tracefall.LogJSON, error) {
-	query := `SELECT "id", "thread", "parent", "app", "name", "time", "time_end", "env", "tags", "notes", "data", "error", "result", "finish" FROM "` + d.params.TableName + `" WHERE "thread"=$1`
+	query := `SELECT ` + d.selectColumns() + ` FROM ` + d.table().quoted() + ` t WHERE "thread"=$1`
 
-	db := d.initDb()
-	defer db.Close()
+	db := d.conn()
 
 	rows, err := db.Query(query, id.String())
 	if err != nil {
@@ -252,14 +304,13 @@ func (d DriverPostgres) getListByThread(id uuid.UUID) ([]*tracefall.LogJSON, err
 }
 
 func (d DriverPostgres) GetLastRootList(limit int) ([]*tracefall.Log, error) {
-	query := `SELECT "id", "thread", "parent", "app", "name", "time", "time_end", "env", "tags", "notes", "data", "error", "result", "finish" 
-		FROM "` + d.params.TableName + `"
+	query := `SELECT ` + d.selectColumns() + `
+		FROM ` + d.table().quoted() + ` t
 		WHERE parent IS NULL
 		ORDER BY time 
 		LIMIT $1`
 
-	db := d.initDb()
-	defer db.Close()
+	db := d.conn()
 
 	rows, err := db.Query(query, limit)
 	if err != nil {
@@ -271,16 +322,15 @@ func (d DriverPostgres) GetLastRootList(limit int) ([]*tracefall.Log, error) {
 }
 
 func (d DriverPostgres) GetLastThreadList(limit int) ([]*tracefall.Log, error) {
-	query := `SELECT "id", "thread", "parent", "app", "name", "time", "time_end", "env", "tags", "notes", "data", "error", "result", "finish"
-		FROM "` + d.params.TableName + `" t
+	query := `SELECT ` + d.selectColumns() + `
+		FROM ` + d.table().quoted() + ` t
 		where t.thread IN (SELECT "id" pid
-			FROM "` + d.params.TableName + `"
+			FROM ` + d.table().quoted() + `
 			WHERE parent is null
 			ORDER BY time DESC
 			LIMIT $1)`
 
-	db := d.initDb()
-	defer db.Close()
+	db := d.conn()
 
 	rows, err := db.Query(query, limit)
 	if err != nil {
@@ -291,6 +341,30 @@ func (d DriverPostgres) GetLastThreadList(limit int) ([]*tracefall.Log, error) {
 	return d.getListResult(rows)
 }
 
+// GetLastListByStatus return last logs with any of the statuses: failed, timed out or still pending children of threads
+func (d DriverPostgres) GetLastListByStatus(limit int, statuses ...tracefall.Status) ([]*tracefall.Log, error) {
+	query := `SELECT ` + d.selectColumns() + `
+		FROM ` + d.table().quoted() + ` t
+		WHERE "status" = ANY($1)
+		ORDER BY time DESC
+		LIMIT $2`
+
+	list := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		list = append(list, string(status))
+	}
+
+	db := d.conn()
+
+	rows, err := db.Query(query, pq.Array(list), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return d.getListResult(rows)
+}
+
 func (d DriverPostgres) GetThread(id uuid.UUID) (tracefall.ResponseThread, error) {
 	resp := tracefall.NewResponse(id)
 	list, err := d.getListByThread(id)
@@ -367,25 +441,26 @@ func (d DriverPostgres) GetLog(id uuid.UUID) (tracefall.ResponseLog, error) {
 */
 
 func (d DriverPostgres) GetLog(id uuid.UUID) (tracefall.ResponseLog, error) {
-	query := `SELECT "id", "thread", "parent", "app", "name", "time", "time_end", "env", "tags", "notes", "data", "error", "result", "finish" FROM "` + d.params.TableName + `" WHERE "id"=$1`
+	query := `SELECT ` + d.selectColumns() + ` FROM ` + d.table().quoted() + ` t WHERE "id"=$1`
 
 	var (
-		l                   = tracefall.LogJSON{}
-		idStr, threadStr    string
-		parentPtr, errorPtr *string
-		notesStr, dataStr   []byte
-		ts                  int64
-		te                  *int64
-		t                   pq.StringArray
+		l                 = tracefall.LogJSON{}
+		idStr, threadStr  string
+		parentPtr         *string
+		notesStr, dataStr []byte
+		errorStr          []byte
+		resourceStr       []byte
+		ts                int64
+		te                *int64
+		t                 pq.StringArray
 	)
 
-	db := d.initDb()
-	defer db.Close()
+	db := d.conn()
 
 	resp := tracefall.NewResponse(id)
 
 	row := db.QueryRow(query, id)
-	switch err := row.Scan(&idStr, &threadStr, &parentPtr, &l.App, &l.Name, &ts, &te, &l.Environment, &t, &notesStr, &dataStr, &errorPtr, &l.Result, &l.Finish); err {
+	switch err := row.Scan(&idStr, &threadStr, &parentPtr, &l.App, &l.Name, &ts, &te, &l.Environment, &t, &notesStr, &dataStr, &errorStr, &l.Result, &l.Finish, &resourceStr, &l.Duration, &l.Status); err {
 	case sql.ErrNoRows:
 		e := errors.New(`not found`)
 		return *resp.SetError(e).ToLog(nil), e
@@ -410,7 +485,12 @@ func (d DriverPostgres) GetLog(id uuid.UUID) (tracefall.ResponseLog, error) {
 		l.Time = ts
 		l.TimeEnd = te
 
-		l.Error = errorPtr
+		if l.Error, err = errorFromJSON(errorStr); err != nil {
+			return *resp.SetError(err).ToLog(nil), nil
+		}
+		if l.Resource, err = resourceFromJSON(resourceStr); err != nil {
+			return *resp.SetError(err).ToLog(nil), nil
+		}
 
 		return *resp.Success().ToLog(&l), nil
 	default:
@@ -418,68 +498,26 @@ func (d DriverPostgres) GetLog(id uuid.UUID) (tracefall.ResponseLog, error) {
 	}
 }
 
-// Create table for tracer
+// Create table for tracer: apply all migrations
 func (d DriverPostgres) CreateTable() error {
-	db := d.initDb()
-	defer db.Close()
-
-	query := `CREATE TABLE IF NOT EXISTS "` + d.params.TableName + `" (
-  id          UUID primary key,
-  thread      UUID NOT NULL,
-  parent      UUID NULL,
-  app         VARCHAR(100) NOT NULL,
-  name        VARCHAR(255) NOT NULL,
-  time        bigint NOT NULL,
-  time_end    bigint NULL,
-  env         VARCHAR(50) default 'dev',
-  tags        text[],
-  notes       jsonb default '[]',
-  data        jsonb default '[]',
-  error       text NULL,
-  result      boolean NOT NULL default false,
-  finish      boolean NOT NULL default false,
-  created     timestamp without time zone default now()
-);`
-	_, err := db.Exec(query)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return d.Migrate(context.Background())
 }
 
-// Create table for tracer
+// Create indexes of table for tracer.
+// Deprecated: indexes are created by migrations, see Migrate
 func (d DriverPostgres) InstallIndex() error {
-	db := d.initDb()
-	defer db.Close()
-
-	query := `	
-	CREATE INDEX IF NOT EXISTS "` + d.params.TableName + `_time_idx" ON "` + d.params.TableName + `"("time");
-	CREATE INDEX IF NOT EXISTS "` + d.params.TableName + `_finish_idx" ON "` + d.params.TableName + `"("finish");
-	CREATE INDEX IF NOT EXISTS "` + d.params.TableName + `_result_idx" ON "` + d.params.TableName + `"("result");
-	CREATE INDEX IF NOT EXISTS "` + d.params.TableName + `_result_idx" ON "` + d.params.TableName + `"("result");
-	CREATE INDEX IF NOT EXISTS "` + d.params.TableName + `_env_idx" ON "` + d.params.TableName + `"("env");
-	CREATE INDEX IF NOT EXISTS "` + d.params.TableName + `_app_idx" ON "` + d.params.TableName + `"("app");
-	CREATE INDEX IF NOT EXISTS "` + d.params.TableName + `_thread_idx" ON "` + d.params.TableName + `"("thread");
-	CREATE INDEX IF NOT EXISTS "` + d.params.TableName + `_parent_idx" ON "` + d.params.TableName + `"("parent");
-	CREATE INDEX IF NOT EXISTS "` + d.params.TableName + `_data_idx" ON "` + d.params.TableName + `" USING GIN ("data");
-	CREATE INDEX IF NOT EXISTS "` + d.params.TableName + `_notes_idx" ON "` + d.params.TableName + `" USING GIN ("notes");
-	CREATE INDEX IF NOT EXISTS "` + d.params.TableName + `_tags_idx" ON "` + d.params.TableName + `" USING GIN ("tags");
-	`
-	_, err := db.Exec(query)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return d.Migrate(context.Background())
 }
 
 // Erase table
 func (d DriverPostgres) DropTable() error {
-	db := d.initDb()
-	defer db.Close()
+	db := d.conn()
 
-	query := `DROP TABLE IF EXISTS ` + d.params.TableName + `;`
+	query := `DROP TABLE IF EXISTS ` + d.table().quoted() + `;
+	DROP TABLE IF EXISTS ` + d.notesTable().quoted() + `;
+	DROP TABLE IF EXISTS ` + d.tagsTable().quoted() + `;
+	DROP TABLE IF EXISTS ` + d.layoutTable().quoted() + `;
+	DROP TABLE IF EXISTS ` + d.versionTable().quoted() + `;`
 
 	_, err := db.Exec(query)
 	if err != nil {
@@ -489,18 +527,15 @@ func (d DriverPostgres) DropTable() error {
 }
 
 func (d DriverPostgres) Truncate(ind string) (tracefall.ResponseCmd, error) {
-	db := d.initDb()
-	defer db.Close()
-
 	resp := tracefall.NewResponse(ind).GenerateID()
 
 	if ind == `` {
 		ind = d.params.TableName
 	}
-	query := `TRUNCATE TABLE ` + ind + `;`
-
-	_, err := db.Exec(query)
-	if err != nil {
+	if !d.owns(ind) {
+		return *resp.SetError(ErrorNotOwnedTable).ToCmd(), ErrorNotOwnedTable
+	}
+	if err := d.truncate(context.Background(), splitIdentifier(ind)); err != nil {
 		return *resp.SetError(err).ToCmd(), err
 	}
 
@@ -508,28 +543,87 @@ func (d DriverPostgres) Truncate(ind string) (tracefall.ResponseCmd, error) {
 }
 
 func (d *DriverPostgres) Open(params map[string]string) (interface{}, error) {
-	d.params.set(params)
-	db := d.initDb()
+	if err := d.params.set(params); err != nil {
+		return nil, err
+	}
+	if err := d.openPool(); err != nil {
+		return nil, err
+	}
 
-	defer db.Close()
+	if err := d.conn().Ping(); err != nil {
+		d.Close()
+		return nil, fmt.Errorf(`couldn't ping postgres database (%s): %w`, d.params.DbName, err)
+	}
 
-	if err := db.Ping(); err != nil {
-		e := errors.New(fmt.Sprintf("Couldn't ping postgre database (%s): error: %s", d.params.DbName, err))
-		panic(e)
+	if d.params.Migrate {
+		if err := d.Migrate(context.Background()); err != nil {
+			return nil, err
+		}
+		if err := d.MigrateLayout(context.Background()); err != nil {
+			return nil, err
+		}
+		if err := d.MigratePartitioning(context.Background()); err != nil {
+			return nil, err
+		}
 	}
 
-	err := d.CreateTable()
+	if err := d.checkLayout(context.Background()); err != nil {
+		return nil, err
+	}
 
+	if d.params.Partition != PartitionNone {
+		if err := d.Maintain(context.Background(), time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+func resourceToJSON(r *tracefall.Resource) (*string, error) {
+	if r == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(r)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	str := string(b)
+	return &str, nil
+}
 
-	err = d.InstallIndex()
+func errorToJSON(e *tracefall.ErrorInfo) (*string, error) {
+	if e == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(e)
 	if err != nil {
 		return nil, err
 	}
+	str := string(b)
+	return &str, nil
+}
 
-	return nil, nil
+func errorFromJSON(b []byte) (*tracefall.ErrorInfo, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	e := &tracefall.ErrorInfo{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func resourceFromJSON(b []byte) (*tracefall.Resource, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	r := &tracefall.Resource{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 func init() {
@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// MaxTableNameLength is limit of table name: names of indexes, partitions and service tables are made from it
+// and have to fit into 63 bytes of Postgres identifiers
+const MaxTableNameLength = 48
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ErrorNotOwnedTable is returned by Truncate for tables which are not owned by the driver
+var ErrorNotOwnedTable = errors.New(`the table is not owned by the driver`)
+
+// identifier is name of the table which may be qualified by schema: `schema.table`
+type identifier struct {
+	schema, name string
+}
+
+// splitIdentifier split name to schema and table. It does not validate the name, see parseIdentifier
+func splitIdentifier(s string) identifier {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return identifier{s[:i], s[i+1:]}
+	}
+	return identifier{name: s}
+}
+
+// parseIdentifier validate and split name of the table: `table` or `schema.table`.
+// Names have letters, digits and underscores only and do not start with digit
+func parseIdentifier(s string) (identifier, error) {
+	id := splitIdentifier(s)
+
+	if id.schema != `` || strings.HasPrefix(s, `.`) {
+		if !identifierPattern.MatchString(id.schema) || len(id.schema) > 63 {
+			return identifier{}, fmt.Errorf(`invalid schema name: %q`, id.schema)
+		}
+	}
+	if !identifierPattern.MatchString(id.name) {
+		return identifier{}, fmt.Errorf(`invalid table name: %q`, s)
+	}
+	if len(id.name) > MaxTableNameLength {
+		return identifier{}, fmt.Errorf(`table name is longer than %d: %q`, MaxTableNameLength, s)
+	}
+
+	return id, nil
+}
+
+// with return identifier of table in the same schema with the suffix: `tracer_schema_version`
+func (id identifier) with(suffix string) identifier {
+	return identifier{id.schema, id.name + suffix}
+}
+
+// quoted return quoted identifier for queries: `"schema"."table"`
+func (id identifier) quoted() string {
+	if id.schema == `` {
+		return pq.QuoteIdentifier(id.name)
+	}
+	return pq.QuoteIdentifier(id.schema) + `.` + pq.QuoteIdentifier(id.name)
+}
+
+// String return name of the table: `schema.table`
+func (id identifier) String() string {
+	if id.schema == `` {
+		return id.name
+	}
+	return id.schema + `.` + id.name
+}
+
+// table return identifier of the table of logs
+func (d DriverPostgres) table() identifier {
+	return splitIdentifier(d.params.TableName)
+}
+
+// owns return true if the table is the table of logs or its partition
+func (d DriverPostgres) owns(name string) bool {
+	table := d.table()
+
+	id, err := parseIdentifier(name)
+	if err != nil {
+		return false
+	}
+	if id.schema == `` {
+		id.schema = table.schema
+	}
+	if id.schema != table.schema {
+		return false
+	}
+	if id.name == table.name {
+		return true
+	}
+
+	if d.params.Partition == PartitionNone {
+		return false
+	}
+	if id.name == table.with(`_default`).name {
+		return true
+	}
+	_, ok := d.params.Partition.parse(table.name, id.name)
+	return ok
+}
@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"text/template"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var hostileNames = []string{
+	`tracer"; DROP TABLE users; --`,
+	`tracer; DROP TABLE users`,
+	`"tracer"`,
+	`tracer' OR '1'='1`,
+	`tracer--`,
+	`tracer name`,
+	`tracer/*`,
+	`public.tracer"; DROP TABLE users; --`,
+	`public"; DROP TABLE users; --.tracer`,
+	`a.b.c`,
+	`.tracer`,
+	`public.`,
+	`1tracer`,
+	`трассировка`,
+	"tracer\x00",
+	``,
+	strings.Repeat(`t`, MaxTableNameLength+1),
+}
+
+// quotedPattern matches quoted identifiers and literals
+var quotedPattern = regexp.MustCompile(`"(?:[^"]|"")*"|'(?:[^']|'')*'`)
+
+func TestIdentifier(t *testing.T) {
+	Convey("Valid names", t, func() {
+		id, err := parseIdentifier(`tracer`)
+		So(err, ShouldBeNil)
+		So(id, ShouldResemble, identifier{name: `tracer`})
+		So(id.quoted(), ShouldEqual, `"tracer"`)
+		So(id.String(), ShouldEqual, `tracer`)
+
+		id, err = parseIdentifier(`logs.Tracer_2`)
+		So(err, ShouldBeNil)
+		So(id, ShouldResemble, identifier{`logs`, `Tracer_2`})
+		So(id.quoted(), ShouldEqual, `"logs"."Tracer_2"`)
+		So(id.String(), ShouldEqual, `logs.Tracer_2`)
+		So(id.with(`_schema_version`).quoted(), ShouldEqual, `"logs"."Tracer_2_schema_version"`)
+
+		_, err = parseIdentifier(strings.Repeat(`t`, MaxTableNameLength))
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Hostile names are rejected", t, func() {
+		for _, name := range hostileNames {
+			_, err := parseIdentifier(name)
+			So(err, ShouldBeError)
+
+			var p Params
+			params := GetConnParams(`localhost`, `db`, name, `user`, ``)
+			So(p.set(params), ShouldBeError)
+		}
+	})
+
+	Convey("Hostile names are quoted", t, func() {
+		list, err := loadMigrations()
+		So(err, ShouldBeNil)
+
+		for _, name := range hostileNames {
+			id := splitIdentifier(name)
+			quoted := id.quoted()
+
+			// every quote inside of the identifier is doubled, so the identifier can not be closed
+			for _, part := range strings.Split(quoted, `"."`) {
+				inner := strings.TrimSuffix(strings.TrimPrefix(part, `"`), `"`)
+				So(strings.Count(inner, `"`)%2, ShouldEqual, 0)
+				So(strings.Contains(strings.ReplaceAll(inner, `""`, ``), `"`), ShouldBeFalse)
+			}
+
+			for _, m := range list {
+				for _, tpl := range []*template.Template{m.Up, m.Down} {
+					sql, err := render(tpl, migrationData{table: id})
+					So(err, ShouldBeNil)
+					So(quotedPattern.ReplaceAllString(sql, ``), ShouldNotContainSubstring, `DROP TABLE users`)
+				}
+			}
+		}
+	})
+
+	Convey("Owned tables", t, func() {
+		d := DriverPostgres{params: Params{TableName: `tracer`}}
+
+		So(d.owns(`tracer`), ShouldBeTrue)
+		So(d.owns(`users`), ShouldBeFalse)
+		So(d.owns(`tracer_schema_version`), ShouldBeFalse)
+		So(d.owns(`tracer_d20190131`), ShouldBeFalse)
+		So(d.owns(`other.tracer`), ShouldBeFalse)
+		for _, name := range hostileNames {
+			So(d.owns(name), ShouldBeFalse)
+		}
+
+		d.params.Partition = PartitionDaily
+		So(d.owns(`tracer_d20190131`), ShouldBeTrue)
+		So(d.owns(`tracer_default`), ShouldBeTrue)
+		So(d.owns(`tracer_w20190128`), ShouldBeFalse)
+
+		d.params.TableName = `logs.tracer`
+		So(d.owns(`tracer`), ShouldBeTrue)
+		So(d.owns(`logs.tracer`), ShouldBeTrue)
+		So(d.owns(`logs.tracer_d20190131`), ShouldBeTrue)
+		So(d.owns(`public.tracer`), ShouldBeFalse)
+	})
+
+	Convey("Truncate of not owned table", t, func() {
+		d := DriverPostgres{params: Params{TableName: `tracer`}}
+
+		resp, err := d.Truncate(`users; DROP TABLE tracer`)
+		So(err, ShouldEqual, ErrorNotOwnedTable)
+		So(resp.Result, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,409 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/efureev/tracefall"
+	"github.com/lib/pq"
+)
+
+// Layout is storage layout of notes and tags
+type Layout string
+
+// Layouts. Denormalized layout stores notes as jsonb and tags as text[] in the table of logs.
+// Normalized layout stores them in tables `<table>_notes` and `<table>_tags`
+const (
+	LayoutDenormalized Layout = `denormalized`
+	LayoutNormalized   Layout = `normalized`
+)
+
+// ErrorLayout is returned by Open without migrations when the table has other layout, see MigrateLayout
+var ErrorLayout = errors.New(`layout of the table differs from the param: the layout has to be migrated by MigrateLayout`)
+
+// ErrorEmptyTags is returned by queries by tags without tags: they would match all logs
+var ErrorEmptyTags = errors.New(`tags are empty`)
+
+// notesTable return identifier of the table of notes
+func (d DriverPostgres) notesTable() identifier {
+	return d.table().with(`_notes`)
+}
+
+// tagsTable return identifier of the table of tags
+func (d DriverPostgres) tagsTable() identifier {
+	return d.table().with(`_tags`)
+}
+
+// layoutTable return identifier of the table which keeps layout of the table of logs
+func (d DriverPostgres) layoutTable() identifier {
+	return d.table().with(`_layout`)
+}
+
+// notesQuery return expression of notes of the log `t` which are aggregated from the table of notes
+// into json of denormalized layout: [{"label":..,"notes":[{"t":..,"v":..}]}]. Groups keep order of NoteGroups.List(),
+// rows without text are groups without notes
+func notesQuery(notes identifier) string {
+	return `COALESCE((SELECT jsonb_agg(jsonb_build_object('label', g."group", 'notes', g."notes") ORDER BY g."first")
+		FROM (SELECT n."group", MIN(n."position") AS "first", COALESCE(jsonb_agg(jsonb_build_object('t', n."time", 'v', n."text")
+				|| jsonb_strip_nulls(jsonb_build_object('l', n."level", 's', n."source", 'e', n."error"))
+				|| CASE WHEN n."attrs" IS NULL THEN '{}' ELSE jsonb_build_object('a', n."attrs") END
+				ORDER BY n."position") FILTER (WHERE n."text" IS NOT NULL), '[]') AS "notes"
+			FROM ` + notes.quoted() + ` n WHERE n."log_id" = t."id" GROUP BY n."group") g), '[]')`
+}
+
+// tagsQuery return expression of tags of the log `t` which are aggregated from the table of tags
+func tagsQuery(tags identifier) string {
+	return `(SELECT array_agg(tg."tag" ORDER BY tg."position") FROM ` + tags.quoted() + ` tg WHERE tg."log_id" = t."id")`
+}
+
+// normalizeQuery return statements which move notes and tags of the table of logs into tables of normalized layout.
+// Statements do nothing when the table has normalized layout already
+func normalizeQuery(table identifier) string {
+	denormalized := `EXISTS (SELECT 1 FROM ` + table.with(`_layout`).quoted() + ` WHERE "layout" = '` + string(LayoutDenormalized) + `')`
+
+	return `INSERT INTO ` + table.with(`_notes`).quoted() + ` ("log_id", "position", "group", "time", "text", "level", "attrs", "source", "error")
+SELECT t."id", row_number() OVER (PARTITION BY t."id" ORDER BY g."ord", n."ord"), COALESCE(g."value"->>'label', ''),
+    CASE WHEN n."ord" IS NOT NULL THEN COALESCE((n."value"->>'t')::bigint, 0) END,
+    CASE WHEN n."ord" IS NOT NULL THEN COALESCE(n."value"->>'v', '') END,
+    n."value"->>'l', n."value"->'a', n."value"->>'s', n."value"->>'e'
+  FROM ` + table.quoted() + ` t
+    CROSS JOIN LATERAL jsonb_array_elements(CASE WHEN jsonb_typeof(t."notes") = 'array' THEN t."notes" ELSE '[]' END)
+      WITH ORDINALITY AS g("value", "ord")
+    LEFT JOIN LATERAL jsonb_array_elements(CASE WHEN jsonb_typeof(g."value"->'notes') = 'array' THEN g."value"->'notes' ELSE '[]' END)
+      WITH ORDINALITY AS n("value", "ord") ON true
+  WHERE ` + denormalized + `
+  ON CONFLICT DO NOTHING;
+
+INSERT INTO ` + table.with(`_tags`).quoted() + ` ("log_id", "position", "tag")
+SELECT t."id", u."ord", u."tag"
+  FROM ` + table.quoted() + ` t, unnest(t."tags") WITH ORDINALITY AS u("tag", "ord")
+  WHERE u."tag" IS NOT NULL AND ` + denormalized + `
+  ON CONFLICT DO NOTHING;
+
+UPDATE ` + table.quoted() + ` SET "notes" = '[]', "tags" = NULL WHERE ` + denormalized + `;
+
+UPDATE ` + table.with(`_layout`).quoted() + ` SET "layout" = '` + string(LayoutNormalized) + `';`
+}
+
+// denormalizeQuery return statements which move notes and tags from tables of normalized layout into the table of logs.
+// Statements do nothing when the table has denormalized layout already
+func denormalizeQuery(table identifier) string {
+	normalized := `EXISTS (SELECT 1 FROM ` + table.with(`_layout`).quoted() + ` WHERE "layout" = '` + string(LayoutNormalized) + `')`
+
+	return `UPDATE ` + table.quoted() + ` AS t SET "notes" = ` + notesQuery(table.with(`_notes`)) + `, "tags" = ` + tagsQuery(table.with(`_tags`)) + `
+  WHERE ` + normalized + `;
+
+DELETE FROM ` + table.with(`_notes`).quoted() + `;
+DELETE FROM ` + table.with(`_tags`).quoted() + `;
+
+UPDATE ` + table.with(`_layout`).quoted() + ` SET "layout" = '` + string(LayoutDenormalized) + `';`
+}
+
+// selectColumns return columns of queries from the table of logs with alias `t`
+func (d DriverPostgres) selectColumns() string {
+	if d.params.Layout != LayoutNormalized {
+		return columns
+	}
+	return strings.NewReplacer(
+		`"notes"`, notesQuery(d.notesTable())+` AS "notes"`,
+		`"tags"`, tagsQuery(d.tagsTable())+` AS "tags"`,
+	).Replace(columns)
+}
+
+// tagsCondition return condition of logs which have all tags of the argument: `$1`
+func (d DriverPostgres) tagsCondition(arg string) string {
+	if d.params.Layout != LayoutNormalized {
+		return arg + ` <@ "tags"`
+	}
+	return `"id" IN (SELECT tg."log_id" FROM ` + d.tagsTable().quoted() + ` tg WHERE tg."tag" = ANY(` + arg + `)
+		GROUP BY tg."log_id" HAVING count(DISTINCT tg."tag") = (SELECT count(DISTINCT u."tag") FROM unnest(` + arg + `::text[]) AS u("tag")))`
+}
+
+// noteCondition return condition of logs which have note in the group (argument `group`) containing the text (argument `text`)
+func (d DriverPostgres) noteCondition(group, text string) string {
+	if d.params.Layout != LayoutNormalized {
+		return `EXISTS (SELECT 1 FROM jsonb_array_elements(CASE WHEN jsonb_typeof("notes") = 'array' THEN "notes" ELSE '[]' END) AS g("value"),
+			jsonb_array_elements(CASE WHEN jsonb_typeof(g."value"->'notes') = 'array' THEN g."value"->'notes' ELSE '[]' END) AS n("value")
+			WHERE g."value"->>'label' = ` + group + ` AND strpos(n."value"->>'v', ` + text + `) > 0)`
+	}
+	return `"id" IN (SELECT n."log_id" FROM ` + d.notesTable().quoted() + ` n
+		WHERE n."group" = ` + group + ` AND strpos(n."text", ` + text + `) > 0)`
+}
+
+// GetListByNote return last logs which have note in the group containing the text
+func (d DriverPostgres) GetListByNote(group, text string, limit int) ([]*tracefall.Log, error) {
+	query := `SELECT ` + d.selectColumns() + `
+		FROM ` + d.table().quoted() + ` t
+		WHERE ` + d.noteCondition(`$1`, `$2`) + `
+		ORDER BY time DESC
+		LIMIT $3`
+
+	rows, err := d.conn().Query(query, group, text, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return d.getListResult(rows)
+}
+
+// GetListByTags return last logs which have all the tags. Return ErrorEmptyTags without tags
+func (d DriverPostgres) GetListByTags(tags tracefall.Tags, limit int) ([]*tracefall.Log, error) {
+	if len(tags) == 0 {
+		return nil, ErrorEmptyTags
+	}
+
+	query := `SELECT ` + d.selectColumns() + `
+		FROM ` + d.table().quoted() + ` t
+		WHERE ` + d.tagsCondition(`$1`) + `
+		ORDER BY time DESC
+		LIMIT $2`
+
+	rows, err := d.conn().Query(query, pq.Array(tags.List()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return d.getListResult(rows)
+}
+
+// remove delete logs by the condition and return count of deleted logs.
+// Notes and tags of normalized layout are deleted by the same statement
+func (d DriverPostgres) remove(ctx context.Context, where string, args ...interface{}) (int64, error) {
+	table := d.table().quoted()
+
+	if d.params.Layout != LayoutNormalized {
+		res, err := d.conn().ExecContext(ctx, `DELETE FROM `+table+` WHERE `+where, args...)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+
+	query := `WITH "removed" AS (DELETE FROM ` + table + ` WHERE ` + where + ` RETURNING "id"),
+		"removed_notes" AS (DELETE FROM ` + d.notesTable().quoted() + ` WHERE "log_id" IN (SELECT "id" FROM "removed")),
+		"removed_tags" AS (DELETE FROM ` + d.tagsTable().quoted() + ` WHERE "log_id" IN (SELECT "id" FROM "removed"))
+		SELECT count(*) FROM "removed"`
+
+	var n int64
+	err := d.conn().QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+// removeChildren delete notes and tags of logs of the table: partition which is truncated or dropped
+func (d DriverPostgres) removeChildren(ctx context.Context, tx *sql.Tx, table string) error {
+	for _, child := range []identifier{d.notesTable(), d.tagsTable()} {
+		query := `DELETE FROM ` + child.quoted() + ` WHERE "log_id" IN (SELECT "id" FROM ` + table + `)`
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// noteRows is notes of the log as columns for unnest. Empty is true for groups without notes:
+// they are stored as rows without time and text
+type noteRows struct {
+	group, text, level, attrs, source, error []string
+	time                                     []int64
+	empty                                    []bool
+}
+
+// notesOf return notes of groups as columns. Empty values are stored as NULL
+func notesOf(groups tracefall.NoteGroupList) (noteRows, error) {
+	var rows noteRows
+	for _, group := range groups {
+		count := 0
+		for _, note := range group.Notes {
+			if note == nil {
+				continue
+			}
+			count++
+
+			var attrs []byte
+			if len(note.Attrs) > 0 {
+				var err error
+				if attrs, err = json.Marshal(note.Attrs); err != nil {
+					return noteRows{}, err
+				}
+			}
+
+			rows.group = append(rows.group, group.Label)
+			rows.time = append(rows.time, note.Time)
+			rows.text = append(rows.text, note.Note)
+			rows.level = append(rows.level, string(note.Level))
+			rows.attrs = append(rows.attrs, string(attrs))
+			rows.source = append(rows.source, note.Source)
+			rows.error = append(rows.error, note.Error)
+			rows.empty = append(rows.empty, false)
+		}
+
+		if count == 0 {
+			rows.group = append(rows.group, group.Label)
+			rows.time = append(rows.time, 0)
+			rows.text = append(rows.text, ``)
+			rows.level = append(rows.level, ``)
+			rows.attrs = append(rows.attrs, ``)
+			rows.source = append(rows.source, ``)
+			rows.error = append(rows.error, ``)
+			rows.empty = append(rows.empty, true)
+		}
+	}
+	return rows, nil
+}
+
+// sendChildren insert notes and tags of the log into their tables
+func (d DriverPostgres) sendChildren(tx *sql.Tx, l *tracefall.Log) error {
+	notes, err := notesOf(l.Notes())
+	if err != nil {
+		return err
+	}
+
+	if len(notes.text) > 0 {
+		query := `INSERT INTO ` + d.notesTable().quoted() + ` ("log_id", "position", "group", "time", "text", "level", "attrs", "source", "error")
+			SELECT $1::uuid, u."ord", u."group", CASE WHEN u."empty" THEN NULL ELSE u."time" END, CASE WHEN u."empty" THEN NULL ELSE u."text" END,
+				NULLIF(u."level", ''), NULLIF(u."attrs", '')::jsonb, NULLIF(u."source", ''), NULLIF(u."error", '')
+			FROM unnest($2::text[], $3::bigint[], $4::text[], $5::text[], $6::text[], $7::text[], $8::text[], $9::boolean[])
+				WITH ORDINALITY AS u("group", "time", "text", "level", "attrs", "source", "error", "empty", "ord")`
+
+		_, err = tx.Exec(query, l.ID.String(), pq.Array(notes.group), pq.Array(notes.time), pq.Array(notes.text),
+			pq.Array(notes.level), pq.Array(notes.attrs), pq.Array(notes.source), pq.Array(notes.error), pq.Array(notes.empty))
+		if err != nil {
+			return err
+		}
+	}
+
+	if tags := l.Tags().List(); len(tags) > 0 {
+		query := `INSERT INTO ` + d.tagsTable().quoted() + ` ("log_id", "position", "tag")
+			SELECT $1::uuid, u."ord", u."tag" FROM unnest($2::text[]) WITH ORDINALITY AS u("tag", "ord")`
+
+		if _, err = tx.Exec(query, l.ID.String(), pq.Array(tags)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendNormalized insert the log, its notes and tags in one transaction. Return id of the log
+func (d DriverPostgres) sendNormalized(query string, l *tracefall.Log, args []interface{}) (string, error) {
+	tx, err := d.conn().Begin()
+	if err != nil {
+		return ``, err
+	}
+	defer tx.Rollback()
+
+	var id string
+	if err = tx.QueryRow(query, args...).Scan(&id); err != nil {
+		return ``, err
+	}
+	if err = d.sendChildren(tx, l); err != nil {
+		return ``, err
+	}
+
+	return id, tx.Commit()
+}
+
+// truncate the table of logs or its partition. Notes and tags of normalized layout are removed too
+func (d DriverPostgres) truncate(ctx context.Context, table identifier) error {
+	if d.params.Layout != LayoutNormalized {
+		_, err := d.conn().ExecContext(ctx, `TRUNCATE TABLE `+table.quoted()+`;`)
+		return err
+	}
+
+	if table.name == d.table().name {
+		_, err := d.conn().ExecContext(ctx, `TRUNCATE TABLE `+table.quoted()+`, `+d.notesTable().quoted()+`, `+d.tagsTable().quoted()+`;`)
+		return err
+	}
+
+	tx, err := d.conn().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = d.removeChildren(ctx, tx, table.quoted()); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `TRUNCATE TABLE `+table.quoted()+`;`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// querier is pool of connections or transaction
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// storedLayout return layout of the table. Tables before migration 6 have denormalized layout, ok is false for them
+func (d DriverPostgres) storedLayout(ctx context.Context, q querier) (layout Layout, ok bool, err error) {
+	if err = q.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, d.layoutTable().quoted()).Scan(&ok); err != nil || !ok {
+		return LayoutDenormalized, false, err
+	}
+	err = q.QueryRowContext(ctx, `SELECT "layout" FROM `+d.layoutTable().quoted()).Scan(&layout)
+	return layout, true, err
+}
+
+// checkLayout return ErrorLayout when the existing table has other layout
+func (d DriverPostgres) checkLayout(ctx context.Context) error {
+	layout, _, err := d.storedLayout(ctx, d.conn())
+	if err != nil {
+		return err
+	}
+	if layout != d.params.Layout {
+		return ErrorLayout
+	}
+	return nil
+}
+
+// MigrateLayout move notes and tags of existing logs to the layout of params. Open calls it when migrations are on.
+// The table has to be migrated to version 6 at least
+func (d DriverPostgres) MigrateLayout(ctx context.Context) error {
+	tx, err := d.conn().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, d.lockKey()); err != nil {
+		return err
+	}
+
+	layout, ok, err := d.storedLayout(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New(`layout is stored by migration 6: the table has to be migrated`)
+	}
+	if layout == d.params.Layout {
+		return nil
+	}
+
+	query := denormalizeQuery(d.table())
+	if d.params.Layout == LayoutNormalized {
+		query = normalizeQuery(d.table())
+	}
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// layoutParam parse param `layout`: denormalized by default
+func layoutParam(params map[string]string) (Layout, error) {
+	switch layout := Layout(params[`layout`]); layout {
+	case ``:
+		return LayoutDenormalized, nil
+	case LayoutDenormalized, LayoutNormalized:
+		return layout, nil
+	default:
+		return ``, fmt.Errorf(`unknown layout: %s`, layout)
+	}
+}
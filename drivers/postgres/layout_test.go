@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/efureev/tracefall"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLayout(t *testing.T) {
+	Convey("Layout param", t, func() {
+		var p Params
+		So(p.set(GetConnParams(`localhost`, `db`, `tracer`, `user`, ``)), ShouldBeNil)
+		So(p.Layout, ShouldEqual, LayoutDenormalized)
+
+		params := GetConnParams(`localhost`, `db`, `tracer`, `user`, ``)
+		params[`layout`] = `normalized`
+		So(p.set(params), ShouldBeNil)
+		So(p.Layout, ShouldEqual, LayoutNormalized)
+
+		params[`layout`] = `flat`
+		So(p.set(params), ShouldBeError)
+	})
+
+	Convey("Queries", t, func() {
+		d := DriverPostgres{params: Params{TableName: `logs.tracer`, Layout: LayoutDenormalized}}
+
+		So(d.selectColumns(), ShouldEqual, columns)
+		So(d.tagsCondition(`$1`), ShouldEqual, `$1 <@ "tags"`)
+		So(d.noteCondition(`$1`, `$2`), ShouldContainSubstring, `jsonb_array_elements(CASE WHEN jsonb_typeof("notes") = 'array'`)
+
+		d.params.Layout = LayoutNormalized
+		So(d.notesTable().quoted(), ShouldEqual, `"logs"."tracer_notes"`)
+		So(d.tagsTable().quoted(), ShouldEqual, `"logs"."tracer_tags"`)
+
+		cols := d.selectColumns()
+		So(cols, ShouldStartWith, `"id", "thread"`)
+		So(cols, ShouldContainSubstring, `FROM "logs"."tracer_notes" n WHERE n."log_id" = t."id" GROUP BY n."group") g), '[]') AS "notes"`)
+		So(cols, ShouldContainSubstring, `FROM "logs"."tracer_tags" tg WHERE tg."log_id" = t."id") AS "tags"`)
+		So(strings.Count(cols, `"tags"`), ShouldEqual, 1)
+		So(strings.Count(cols, `g), '[]') AS "notes"`), ShouldEqual, 1)
+
+		So(d.tagsCondition(`$1`), ShouldStartWith, `"id" IN (SELECT tg."log_id" FROM "logs"."tracer_tags" tg WHERE tg."tag" = ANY($1)`)
+		So(d.noteCondition(`$1`, `$2`), ShouldContainSubstring, `WHERE n."group" = $1 AND strpos(n."text", $2) > 0`)
+		So(cols, ShouldContainSubstring, `FILTER (WHERE n."text" IS NOT NULL), '[]') AS "notes"`)
+	})
+
+	Convey("Empty tags", t, func() {
+		for _, layout := range []Layout{LayoutDenormalized, LayoutNormalized} {
+			d := DriverPostgres{params: Params{TableName: `tracer`, Layout: layout}}
+
+			list, err := d.GetListByTags(tracefall.Tags{}, 10)
+			So(err, ShouldEqual, ErrorEmptyTags)
+			So(list, ShouldBeNil)
+
+			resp, err := d.RemoveByTags(nil)
+			So(err, ShouldEqual, ErrorEmptyTags)
+			So(resp.Result, ShouldBeFalse)
+		}
+	})
+
+	Convey("Layout queries", t, func() {
+		table := identifier{`logs`, `tracer`}
+
+		query := normalizeQuery(table)
+		So(query, ShouldContainSubstring, `INSERT INTO "logs"."tracer_notes" ("log_id", "position", "group", "time", "text", "level", "attrs", "source", "error")`)
+		So(query, ShouldContainSubstring, `LEFT JOIN LATERAL jsonb_array_elements(`)
+		So(query, ShouldContainSubstring, `WHERE EXISTS (SELECT 1 FROM "logs"."tracer_layout" WHERE "layout" = 'denormalized')`)
+		So(query, ShouldEndWith, `UPDATE "logs"."tracer_layout" SET "layout" = 'normalized';`)
+
+		query = denormalizeQuery(table)
+		So(query, ShouldStartWith, `UPDATE "logs"."tracer" AS t SET "notes" = COALESCE(`)
+		So(query, ShouldContainSubstring, `WHERE EXISTS (SELECT 1 FROM "logs"."tracer_layout" WHERE "layout" = 'normalized');`)
+		So(query, ShouldContainSubstring, `DELETE FROM "logs"."tracer_tags";`)
+		So(query, ShouldEndWith, `UPDATE "logs"."tracer_layout" SET "layout" = 'denormalized';`)
+	})
+
+	Convey("Notes as columns", t, func() {
+		groups := tracefall.NewNotesGroups()
+		groups.Add(`step`, `first`)
+		groups.AddNote(`step`, tracefall.NewLevelNote(tracefall.LevelWarn, `second`, tracefall.NewAttr(`n`, 1)).
+			SetError(errors.New(`fail`)))
+		groups.AddNoteGroup(tracefall.NewNoteGroup(`empty`))
+
+		rows, err := notesOf(groups.List())
+		So(err, ShouldBeNil)
+		So(rows.group, ShouldResemble, []string{`empty`, `step`, `step`})
+		So(rows.text, ShouldResemble, []string{``, `first`, `second`})
+		So(rows.level, ShouldResemble, []string{``, ``, `warn`})
+		So(rows.attrs, ShouldResemble, []string{``, ``, `{"n":1}`})
+		So(rows.error, ShouldResemble, []string{``, ``, `fail`})
+		So(rows.source, ShouldResemble, []string{``, ``, ``})
+		So(rows.empty, ShouldResemble, []bool{true, false, false})
+		So(rows.time, ShouldHaveLength, 3)
+
+		rows, err = notesOf(nil)
+		So(err, ShouldBeNil)
+		So(rows.text, ShouldBeEmpty)
+
+		groups.AddNote(`bad`, tracefall.NewNote(`chan`).AddAttrs(tracefall.NewAttr(`ch`, make(chan int))))
+		_, err = notesOf(groups.List())
+		So(err, ShouldBeError)
+	})
+}
+
+func TestNormalizedLayout(t *testing.T) {
+	Convey("Normalized layout", t, func() {
+		params := rightConnParams()
+		params[`table`] += `_norm`
+		params[`layout`] = `normalized`
+
+		db, err := tracefall.Open(`postgres`, params)
+		So(err, ShouldBeNil)
+
+		d := db.Driver().(*DriverPostgres)
+		So(d.DropTable(), ShouldBeNil)
+		So(d.CreateTable(), ShouldBeNil)
+		So(d.checkLayout(context.Background()), ShouldBeNil)
+
+		l := tracefall.NewLog(`Root`)
+		l.AddTag(`root`).AddTag(`api`)
+		l.NoteWarn(`sql`, `select users`).AddNotes(`http`, `GET /users`).AddNoteGroup(tracefall.NewNoteGroup(`empty`))
+
+		resp, err := db.Send(l)
+		So(err, ShouldBeNil)
+		So(resp.ID, ShouldEqual, l.ID.String())
+
+		child, _ := l.CreateChild(`Child`)
+		child.AddTag(`api`)
+		child.Success()
+		_, err = db.Send(child)
+		So(err, ShouldBeNil)
+
+		lGet, err := db.GetLog(l.ID)
+		So(err, ShouldBeNil)
+		So(lGet.Log.Tags, ShouldResemble, l.Tags().List())
+		// groups without notes go first
+		So(lGet.Log.Notes, ShouldHaveLength, 3)
+		So(lGet.Log.Notes[0].Label, ShouldEqual, `empty`)
+		So(lGet.Log.Notes[0].Notes, ShouldBeEmpty)
+		So(lGet.Log.Notes[1:], ShouldResemble, l.ToLogJSON().Notes[1:])
+
+		list, err := d.GetListByNote(`sql`, `users`, 10)
+		So(err, ShouldBeNil)
+		So(list, ShouldHaveLength, 1)
+		So(list[0].ID, ShouldEqual, l.ID)
+
+		list, err = d.GetListByNote(`http`, `select`, 10)
+		So(err, ShouldBeNil)
+		So(list, ShouldBeEmpty)
+
+		list, err = d.GetListByTags(tracefall.Tags{`api`}, 10)
+		So(err, ShouldBeNil)
+		So(list, ShouldHaveLength, 2)
+
+		list, err = d.GetListByTags(tracefall.Tags{`api`, `root`}, 10)
+		So(err, ShouldBeNil)
+		So(list, ShouldHaveLength, 1)
+
+		_, err = db.RemoveByTags(tracefall.Tags{`root`})
+		So(err, ShouldBeNil)
+
+		var notes int
+		So(d.conn().QueryRow(`SELECT count(*) FROM `+d.notesTable().quoted()).Scan(&notes), ShouldBeNil)
+		So(notes, ShouldEqual, 0)
+
+		_, err = db.RemoveThread(l.Thread)
+		So(err, ShouldBeNil)
+
+		Convey("Layout of existing table", func() {
+			ctx := context.Background()
+			l := tracefall.NewLog(`Switched`)
+			l.AddTag(`switched`)
+			l.AddNotes(`sql`, `select users`).AddNoteGroup(tracefall.NewNoteGroup(`empty`))
+			_, err := db.Send(l)
+			So(err, ShouldBeNil)
+
+			d.params.Layout = LayoutDenormalized
+			So(d.checkLayout(ctx), ShouldEqual, ErrorLayout)
+			So(d.MigrateLayout(ctx), ShouldBeNil)
+			So(d.checkLayout(ctx), ShouldBeNil)
+
+			lGet, err := d.GetLog(l.ID)
+			So(err, ShouldBeNil)
+			So(lGet.Log.Tags, ShouldResemble, l.Tags().List())
+			So(lGet.Log.Notes, ShouldHaveLength, 2)
+			So(lGet.Log.Notes[0].Label, ShouldEqual, `empty`)
+			So(lGet.Log.Notes[1:], ShouldResemble, l.ToLogJSON().Notes[1:])
+
+			d.params.Layout = LayoutNormalized
+			So(d.checkLayout(ctx), ShouldEqual, ErrorLayout)
+			So(d.MigrateLayout(ctx), ShouldBeNil)
+			So(d.checkLayout(ctx), ShouldBeNil)
+
+			lGet, err = d.GetLog(l.ID)
+			So(err, ShouldBeNil)
+			So(lGet.Log.Notes, ShouldHaveLength, 2)
+			So(lGet.Log.Notes[1:], ShouldResemble, l.ToLogJSON().Notes[1:])
+
+			So(d.MigrateTo(ctx, 5), ShouldBeNil)
+			So(d.checkLayout(ctx), ShouldEqual, ErrorLayout)
+			So(d.MigrateLayout(ctx), ShouldBeError)
+
+			d.params.Layout = LayoutDenormalized
+			So(d.checkLayout(ctx), ShouldBeNil)
+			So(d.DropTable(), ShouldBeNil)
+		})
+	})
+}
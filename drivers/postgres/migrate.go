@@ -0,0 +1,257 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/lib/pq"
+)
+
+// latestVersion is target of migrate which means the last migration
+const latestVersion = -1
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is versioned change of the schema. Up and down are templates of SQL, see migrationData
+type migration struct {
+	Version  int
+	Name     string
+	Up, Down *template.Template
+}
+
+// migrationData is data of migration templates: {{.Table}}, {{.Literal}}, {{.Index "time"}}, {{.Notes}}, ...
+// Migrations do not depend on params: layout and partitioning are changed by MigrateLayout and MigratePartitioning
+type migrationData struct {
+	table identifier
+}
+
+// Table return quoted name of the table
+func (m migrationData) Table() string {
+	return m.table.quoted()
+}
+
+// Literal return name of the table as string literal: for regclass casts
+func (m migrationData) Literal() string {
+	return pq.QuoteLiteral(m.Table())
+}
+
+// Notes return quoted name of the table of notes
+func (m migrationData) Notes() string {
+	return m.table.with(`_notes`).quoted()
+}
+
+// Tags return quoted name of the table of tags
+func (m migrationData) Tags() string {
+	return m.table.with(`_tags`).quoted()
+}
+
+// Layout return quoted name of the table which keeps layout of the table of logs
+func (m migrationData) Layout() string {
+	return m.table.with(`_layout`).quoted()
+}
+
+// Denormalize return statements which move notes and tags back into the table of logs
+func (m migrationData) Denormalize() string {
+	return denormalizeQuery(m.table)
+}
+
+// Index return quoted name of the index of the table by column name. Index is created in the schema of the table
+func (m migrationData) Index(column string) string {
+	return pq.QuoteIdentifier(m.table.name + `_` + column + `_idx`)
+}
+
+// loadMigrations parse embedded migrations: `0001_name.up.sql` and `0001_name.down.sql`. Return them ordered by version
+func loadMigrations() ([]*migration, error) {
+	entries, err := migrationFiles.ReadDir(`migrations`)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		base := strings.TrimSuffix(name, `.sql`)
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+
+		parts := strings.SplitN(base, `_`, 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 || (direction != `.up` && direction != `.down`) {
+			return nil, fmt.Errorf(`invalid migration file name: %s`, name)
+		}
+
+		b, err := migrationFiles.ReadFile(`migrations/` + name)
+		if err != nil {
+			return nil, err
+		}
+		tpl, err := template.New(name).Parse(string(b))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+		if direction == `.up` {
+			m.Up = tpl
+		} else {
+			m.Down = tpl
+		}
+	}
+
+	list := make([]*migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == nil || m.Down == nil {
+			return nil, fmt.Errorf(`migration %04d_%s has no up or down file`, m.Version, m.Name)
+		}
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+	for i, m := range list {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf(`migration %d is missing`, i+1)
+		}
+	}
+
+	return list, nil
+}
+
+func render(tpl *template.Template, data migrationData) (string, error) {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return ``, err
+	}
+	return buf.String(), nil
+}
+
+// versionTable return name of the table of schema versions
+func (d DriverPostgres) versionTable() identifier {
+	return d.table().with(`_schema_version`)
+}
+
+// lockKey return key of advisory lock of migrations of the table
+func (d DriverPostgres) lockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte(`tracefall:` + d.table().String()))
+	return int64(h.Sum64())
+}
+
+// SchemaVersion return version of the schema of the table. Zero means that migrations were not applied
+func (d DriverPostgres) SchemaVersion(ctx context.Context) (int, error) {
+	db := d.conn()
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, d.versionTable().quoted()).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX("version"), 0) FROM `+d.versionTable().quoted()).Scan(&version)
+	return version, err
+}
+
+// Migrate apply migrations which are not applied yet. Migrations are applied in one transaction under advisory lock,
+// so services which start concurrently do not conflict
+func (d DriverPostgres) Migrate(ctx context.Context) error {
+	return d.migrate(ctx, latestVersion)
+}
+
+// MigrateTo apply or revert migrations up to the version. Version 0 reverts all migrations: the table is dropped
+func (d DriverPostgres) MigrateTo(ctx context.Context, version int) error {
+	return d.migrate(ctx, version)
+}
+
+func (d DriverPostgres) migrate(ctx context.Context, target int) error {
+	list, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if target == latestVersion {
+		target = len(list)
+	}
+	if target < 0 || target > len(list) {
+		return fmt.Errorf(`unknown schema version: %d`, target)
+	}
+
+	db := d.conn()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, d.lockKey()); err != nil {
+		return err
+	}
+
+	versions := d.versionTable().quoted()
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+versions+` (
+  version     integer primary key,
+  name        VARCHAR(255) NOT NULL,
+  applied     timestamp without time zone default now()
+)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX("version"), 0) FROM `+versions).Scan(&current); err != nil {
+		return err
+	}
+
+	for _, m := range list {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+		if err = d.apply(ctx, tx, m, m.Up); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, `INSERT INTO `+versions+` ("version", "name") VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+			return err
+		}
+	}
+
+	for i := len(list) - 1; i >= 0; i-- {
+		m := list[i]
+		if m.Version > current || m.Version <= target {
+			continue
+		}
+		if err = d.apply(ctx, tx, m, m.Down); err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, `DELETE FROM `+versions+` WHERE "version" = $1`, m.Version); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d DriverPostgres) apply(ctx context.Context, tx *sql.Tx, m *migration, tpl *template.Template) error {
+	query, err := render(tpl, migrationData{table: d.table()})
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf(`migration %04d_%s: %s`, m.Version, m.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/efureev/tracefall"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMigrations(t *testing.T) {
+	Convey("Load migrations", t, func() {
+		list, err := loadMigrations()
+
+		So(err, ShouldBeNil)
+		So(len(list), ShouldBeGreaterThanOrEqualTo, 5)
+		for i, m := range list {
+			So(m.Version, ShouldEqual, i+1)
+			So(m.Name, ShouldNotBeEmpty)
+			So(m.Up, ShouldNotBeNil)
+			So(m.Down, ShouldNotBeNil)
+		}
+		So(list[0].Name, ShouldEqual, `create_table`)
+
+		Convey("Render", func() {
+			data := migrationData{table: identifier{name: `tracer`}}
+			for _, m := range list {
+				up, err := render(m.Up, data)
+				So(err, ShouldBeNil)
+				So(up, ShouldContainSubstring, `"tracer`)
+				So(up, ShouldNotContainSubstring, `{{`)
+
+				down, err := render(m.Down, data)
+				So(err, ShouldBeNil)
+				So(down, ShouldContainSubstring, `"tracer"`)
+			}
+
+			up, _ := render(list[0].Up, data)
+			So(up, ShouldContainSubstring, `CREATE INDEX IF NOT EXISTS "tracer_time_idx" ON "tracer" ("time")`)
+
+			up, _ = render(list[3].Up, data)
+			So(up, ShouldContainSubstring, `attrelid = '"tracer"'::regclass`)
+		})
+
+		Convey("Render partitioned", func() {
+			up, err := render(list[0].Up, migrationData{table: identifier{name: `tracer`}})
+			So(err, ShouldBeNil)
+			So(up, ShouldContainSubstring, `id          UUID primary key,`)
+			So(up, ShouldNotContainSubstring, `PARTITION`)
+
+			for _, m := range list {
+				So(m.Name, ShouldNotEqual, `partitioning`)
+			}
+		})
+	})
+
+	Convey("Render normalized", t, func() {
+		list, _ := loadMigrations()
+		m := list[5]
+		So(m.Name, ShouldEqual, `normalized_layout`)
+
+		up, err := render(m.Up, migrationData{table: identifier{`logs`, `tracer`}})
+		So(err, ShouldBeNil)
+		So(up, ShouldContainSubstring, `CREATE TABLE IF NOT EXISTS "logs"."tracer_notes" (`)
+		So(up, ShouldContainSubstring, `CREATE TABLE IF NOT EXISTS "logs"."tracer_tags" (`)
+		So(up, ShouldContainSubstring, `CREATE INDEX IF NOT EXISTS "tracer_tags_tag_idx" ON "logs"."tracer_tags" ("tag");`)
+		So(up, ShouldContainSubstring, `INSERT INTO "logs"."tracer_layout" ("layout") SELECT 'denormalized'`)
+		So(up, ShouldNotContainSubstring, `UPDATE`)
+
+		down, err := render(m.Down, migrationData{table: identifier{`logs`, `tracer`}})
+		So(err, ShouldBeNil)
+		So(down, ShouldContainSubstring, denormalizeQuery(identifier{`logs`, `tracer`}))
+		So(down, ShouldContainSubstring, `FROM "logs"."tracer_notes" n WHERE n."log_id" = t."id"`)
+		So(down, ShouldContainSubstring, `DROP TABLE IF EXISTS "logs"."tracer_tags";`)
+		So(down, ShouldContainSubstring, `DROP TABLE IF EXISTS "logs"."tracer_layout";`)
+	})
+
+	Convey("Lock key", t, func() {
+		d1 := DriverPostgres{params: Params{TableName: `tracer`}}
+		d2 := DriverPostgres{params: Params{TableName: `other`}}
+
+		So(d1.lockKey(), ShouldEqual, d1.lockKey())
+		So(d1.lockKey(), ShouldNotEqual, d2.lockKey())
+		So(d1.versionTable().String(), ShouldEqual, `tracer_schema_version`)
+	})
+
+	Convey("Params", t, func() {
+		var p Params
+		So(p.set(GetConnParams(`localhost`, `db`, `tracer`, `user`, ``)), ShouldBeNil)
+		So(p.Migrate, ShouldBeTrue)
+
+		params := GetConnParams(`localhost`, `db`, `tracer`, `user`, ``)
+		params[`migrate`] = `false`
+		So(p.set(params), ShouldBeNil)
+		So(p.Migrate, ShouldBeFalse)
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	Convey("Migrate", t, func() {
+		db, err := tracefall.Open(`postgres`, rightConnParams())
+		So(err, ShouldBeNil)
+
+		d := db.Driver().(*DriverPostgres)
+		ctx := context.Background()
+
+		list, _ := loadMigrations()
+		version, err := d.SchemaVersion(ctx)
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, len(list))
+
+		So(d.MigrateTo(ctx, 1), ShouldBeNil)
+		version, _ = d.SchemaVersion(ctx)
+		So(version, ShouldEqual, 1)
+
+		So(d.Migrate(ctx), ShouldBeNil)
+		So(d.Migrate(ctx), ShouldBeNil)
+		version, _ = d.SchemaVersion(ctx)
+		So(version, ShouldEqual, len(list))
+
+		So(strings.Contains(d.MigrateTo(ctx, len(list)+1).Error(), `unknown`), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS {{.Table}} (
+  id          UUID primary key,
+  thread      UUID NOT NULL,
+  parent      UUID NULL,
+  app         VARCHAR(100) NOT NULL,
+  name        VARCHAR(255) NOT NULL,
+  time        bigint NOT NULL,
+  time_end    bigint NULL,
+  env         VARCHAR(50) default 'dev',
+  tags        text[],
+  notes       jsonb default '[]',
+  data        jsonb default '[]',
+  error       text NULL,
+  result      boolean NOT NULL default false,
+  finish      boolean NOT NULL default false,
+  created     timestamp without time zone default now()
+);
+
+CREATE INDEX IF NOT EXISTS {{.Index "time"}} ON {{.Table}} ("time");
+CREATE INDEX IF NOT EXISTS {{.Index "finish"}} ON {{.Table}} ("finish");
+CREATE INDEX IF NOT EXISTS {{.Index "result"}} ON {{.Table}} ("result");
+CREATE INDEX IF NOT EXISTS {{.Index "env"}} ON {{.Table}} ("env");
+CREATE INDEX IF NOT EXISTS {{.Index "app"}} ON {{.Table}} ("app");
+CREATE INDEX IF NOT EXISTS {{.Index "thread"}} ON {{.Table}} ("thread");
+CREATE INDEX IF NOT EXISTS {{.Index "parent"}} ON {{.Table}} ("parent");
+CREATE INDEX IF NOT EXISTS {{.Index "data"}} ON {{.Table}} USING GIN ("data");
+CREATE INDEX IF NOT EXISTS {{.Index "notes"}} ON {{.Table}} USING GIN ("notes");
+CREATE INDEX IF NOT EXISTS {{.Index "tags"}} ON {{.Table}} USING GIN ("tags");
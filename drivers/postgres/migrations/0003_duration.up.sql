@@ -0,0 +1,5 @@
+ALTER TABLE {{.Table}} ADD COLUMN IF NOT EXISTS "duration" bigint NULL;
+
+UPDATE {{.Table}} SET "duration" = "time_end" - "time" WHERE "duration" IS NULL AND "time_end" IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS {{.Index "duration"}} ON {{.Table}} ("duration");
@@ -0,0 +1 @@
+ALTER TABLE {{.Table}} ALTER COLUMN "error" TYPE text USING "error"->>'message';
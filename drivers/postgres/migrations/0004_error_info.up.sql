@@ -0,0 +1,7 @@
+DO $$
+BEGIN
+  IF (SELECT atttypid FROM pg_attribute WHERE attrelid = {{.Literal}}::regclass AND attname = 'error') = 'text'::regtype THEN
+    ALTER TABLE {{.Table}} ALTER COLUMN "error" TYPE jsonb
+      USING CASE WHEN "error" IS NULL THEN NULL ELSE jsonb_build_object('message', "error") END;
+  END IF;
+END $$;
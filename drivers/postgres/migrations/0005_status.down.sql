@@ -0,0 +1 @@
+ALTER TABLE {{.Table}} DROP COLUMN IF EXISTS "status";
@@ -0,0 +1,13 @@
+ALTER TABLE {{.Table}} ADD COLUMN IF NOT EXISTS "status" VARCHAR(20) NULL;
+
+UPDATE {{.Table}} SET "status" = CASE
+    WHEN "time_end" IS NULL THEN 'pending'
+    WHEN "result" THEN 'success'
+    ELSE 'failed'
+  END
+  WHERE "status" IS NULL;
+
+ALTER TABLE {{.Table}} ALTER COLUMN "status" SET DEFAULT 'pending';
+ALTER TABLE {{.Table}} ALTER COLUMN "status" SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS {{.Index "status"}} ON {{.Table}} ("status");
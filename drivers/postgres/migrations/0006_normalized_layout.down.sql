@@ -0,0 +1,5 @@
+{{.Denormalize}}
+
+DROP TABLE IF EXISTS {{.Notes}};
+DROP TABLE IF EXISTS {{.Tags}};
+DROP TABLE IF EXISTS {{.Layout}};
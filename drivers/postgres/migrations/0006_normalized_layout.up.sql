@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS {{.Notes}} (
+  log_id      UUID NOT NULL,
+  position    integer NOT NULL,
+  "group"     text NOT NULL,
+  time        bigint NULL,
+  text        text NULL,
+  level       VARCHAR(20) NULL,
+  attrs       jsonb NULL,
+  source      text NULL,
+  error       text NULL,
+  PRIMARY KEY (log_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS {{.Tags}} (
+  log_id      UUID NOT NULL,
+  position    integer NOT NULL,
+  tag         text NOT NULL,
+  PRIMARY KEY (log_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS {{.Index "notes_grp"}} ON {{.Notes}} ("group", "time");
+CREATE INDEX IF NOT EXISTS {{.Index "tags_tag"}} ON {{.Tags}} ("tag");
+
+CREATE TABLE IF NOT EXISTS {{.Layout}} (
+  layout      VARCHAR(20) NOT NULL
+);
+
+INSERT INTO {{.Layout}} ("layout") SELECT 'denormalized' WHERE NOT EXISTS (SELECT 1 FROM {{.Layout}});
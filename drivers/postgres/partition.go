@@ -0,0 +1,392 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/efureev/tracefall"
+	"github.com/lib/pq"
+)
+
+// Partitioning is range partitioning of the table by time of logs
+type Partitioning string
+
+// Partitionings
+const (
+	PartitionNone   Partitioning = ``
+	PartitionDaily  Partitioning = `daily`
+	PartitionWeekly Partitioning = `weekly`
+)
+
+// Defaults of params
+const (
+	DefaultPartitionsAhead = 3
+	DefaultRemoveBatch     = 1000
+)
+
+// ErrorNotPartitioned is returned by Maintain when partitioning is set, but the table is not partitioned, see MigratePartitioning
+var ErrorNotPartitioned = errors.New(`the table is not partitioned: the table has to be partitioned by MigratePartitioning`)
+
+// logIndexes is indexes of the table of logs which are created by migrations: column and index method
+var logIndexes = [][2]string{
+	{`time`, `btree`}, {`finish`, `btree`}, {`result`, `btree`}, {`env`, `btree`}, {`app`, `btree`}, {`thread`, `btree`},
+	{`parent`, `btree`}, {`data`, `gin`}, {`notes`, `gin`}, {`tags`, `gin`}, {`duration`, `btree`}, {`status`, `btree`},
+}
+
+// prefix return prefix of partition name: `d` for daily and `w` for weekly partitions
+func (p Partitioning) prefix() string {
+	if p == PartitionWeekly {
+		return `w`
+	}
+	return `d`
+}
+
+// start return start of partition which contains the time. Partitions are in UTC, weeks start on Monday
+func (p Partitioning) start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if p == PartitionWeekly {
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+// next return start of the next partition
+func (p Partitioning) next(start time.Time) time.Time {
+	if p == PartitionWeekly {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// name return name of partition of the table by its start: `tracer_d20190131`
+func (p Partitioning) name(table string, start time.Time) string {
+	return table + `_` + p.prefix() + start.Format(`20060102`)
+}
+
+// parse return start of partition of the table by its name
+func (p Partitioning) parse(table, name string) (time.Time, bool) {
+	date := strings.TrimPrefix(name, table+`_`+p.prefix())
+	if date == name || len(date) != len(`20060102`) {
+		return time.Time{}, false
+	}
+	start, err := time.Parse(`20060102`, date)
+	if err != nil || !start.Equal(p.start(start)) {
+		return time.Time{}, false
+	}
+	return start, true
+}
+
+// partitionPlan is changes of partitions of the table
+type partitionPlan struct {
+	create []time.Time
+	drop   []string
+}
+
+// plan return partitions which have to be created (current and ahead) and dropped (older than retention)
+func (d DriverPostgres) plan(now time.Time, existing []string) partitionPlan {
+	var (
+		res   partitionPlan
+		p     = d.params.Partition
+		table = d.table().name
+		have  = make(map[string]bool, len(existing))
+	)
+
+	for _, name := range existing {
+		have[name] = true
+	}
+
+	start := p.start(now)
+	for i := 0; i <= d.params.PartitionsAhead; i++ {
+		if !have[p.name(table, start)] {
+			res.create = append(res.create, start)
+		}
+		start = p.next(start)
+	}
+
+	if d.params.RetentionDays > 0 {
+		cutoff := now.AddDate(0, 0, -d.params.RetentionDays)
+		for _, name := range existing {
+			if start, ok := p.parse(table, name); ok && !p.next(start).After(cutoff) {
+				res.drop = append(res.drop, name)
+			}
+		}
+	}
+
+	return res
+}
+
+// Maintain create current and ahead partitions and drop partitions which are older than retention.
+// Logs of the default partition which are older than retention are removed too.
+// Logs older than retention are removed by RemoveOlderThan from the table without partitioning.
+// It has to be called periodically (see StartMaintenance), Open calls it for partitioned tables
+func (d DriverPostgres) Maintain(ctx context.Context, now time.Time) error {
+	if d.params.Partition == PartitionNone {
+		if d.params.RetentionDays == 0 {
+			return nil
+		}
+		_, err := d.RemoveOlderThan(ctx, now.AddDate(0, 0, -d.params.RetentionDays))
+		return err
+	}
+
+	db := d.conn()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, d.lockKey()); err != nil {
+		return err
+	}
+
+	table := d.table().quoted()
+
+	partitioned, err := d.partitioned(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if !partitioned {
+		return ErrorNotPartitioned
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass($1)`, table)
+	if err != nil {
+		return err
+	}
+	var existing []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing = append(existing, name)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	var (
+		plan = d.plan(now, existing)
+		p    = d.params.Partition
+		def  string
+	)
+	for _, name := range existing {
+		if name == d.table().name+`_default` {
+			def = d.partition(name)
+		}
+	}
+
+	for _, start := range plan.create {
+		err = d.createPartition(ctx, tx, p.name(d.table().name, start), start.UnixNano(), p.next(start).UnixNano(), def)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range plan.drop {
+		if d.params.Layout == LayoutNormalized {
+			if err = d.removeChildren(ctx, tx, d.partition(name)); err != nil {
+				return err
+			}
+		}
+		if _, err = tx.ExecContext(ctx, `DROP TABLE IF EXISTS `+d.partition(name)); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	// rows which are out of partitions are in the default partition, they are removed like rows of the table without partitioning
+	if def == `` || d.params.RetentionDays == 0 {
+		return nil
+	}
+	return d.removeBefore(ctx, def, now.AddDate(0, 0, -d.params.RetentionDays))
+}
+
+// partitioned return true when the table of logs is partitioned
+func (d DriverPostgres) partitioned(ctx context.Context, q querier) (partitioned bool, err error) {
+	err = q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = to_regclass($1))`, d.table().quoted()).
+		Scan(&partitioned)
+	return partitioned, err
+}
+
+// partitioningQuery return statements which move rows of the table of logs to the new table: partitioned by time
+// (rows are in the `<table>_default` partition) or not partitioned one. Primary key and indexes of migrations are recreated
+func (d DriverPostgres) partitioningQuery(partitioned bool) []string {
+	var (
+		m       = migrationData{table: d.table()}
+		table   = m.Table()
+		suffix  = `partitioned`
+		options = ``
+		key     = `"id"`
+	)
+	if partitioned {
+		suffix, options, key = `unpartitioned`, ` PARTITION BY RANGE ("time")`, `"id", "time"`
+	}
+	old := d.table().with(`_` + suffix).quoted()
+
+	queries := []string{
+		`ALTER TABLE ` + table + ` RENAME TO ` + pq.QuoteIdentifier(d.table().name+`_`+suffix),
+		`CREATE TABLE ` + table + ` (LIKE ` + old + ` INCLUDING DEFAULTS)` + options,
+	}
+	if partitioned {
+		queries = append(queries, `CREATE TABLE `+d.table().with(`_default`).quoted()+` PARTITION OF `+table+` DEFAULT`)
+	}
+	queries = append(queries,
+		`INSERT INTO `+table+` SELECT * FROM `+old,
+		`DROP TABLE `+old,
+		`ALTER TABLE `+table+` ADD PRIMARY KEY (`+key+`)`,
+	)
+	for _, index := range logIndexes {
+		queries = append(queries, `CREATE INDEX `+m.Index(index[0])+` ON `+table+` USING `+index[1]+` ("`+index[0]+`")`)
+	}
+	return queries
+}
+
+// MigratePartitioning move rows of the table to partitioning of params: the table is partitioned by time when
+// partitioning is set and it is not partitioned otherwise. Open calls it when migrations are on.
+// The table has to be migrated to the last version
+func (d DriverPostgres) MigratePartitioning(ctx context.Context) error {
+	list, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.conn().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, d.lockKey()); err != nil {
+		return err
+	}
+
+	version, err := d.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version != len(list) {
+		return errors.New(`partitioning is changed for the last schema version: the table has to be migrated`)
+	}
+
+	partitioned, err := d.partitioned(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if partitioned == (d.params.Partition != PartitionNone) {
+		return nil
+	}
+
+	for _, query := range d.partitioningQuery(!partitioned) {
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// createPartition create partition of the table by its name and bounds of time. Rows of these bounds in the default
+// partition would fail creation of the partition, so the default partition is detached and these rows are moved to the new one
+func (d DriverPostgres) createPartition(ctx context.Context, tx *sql.Tx, name string, from, to int64, def string) error {
+	var (
+		table = d.table().quoted()
+		// bounds of partition can not be passed as parameters, they are integers
+		lower, upper = strconv.FormatInt(from, 10), strconv.FormatInt(to, 10)
+		create       = `CREATE TABLE IF NOT EXISTS ` + d.partition(name) + ` PARTITION OF ` + table +
+			` FOR VALUES FROM (` + lower + `) TO (` + upper + `)`
+	)
+
+	var conflict bool
+	if def != `` {
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+def+` WHERE "time" >= $1 AND "time" < $2)`, from, to).
+			Scan(&conflict)
+		if err != nil {
+			return err
+		}
+	}
+	if !conflict {
+		_, err := tx.ExecContext(ctx, create)
+		return err
+	}
+
+	for _, query := range []string{
+		`ALTER TABLE ` + table + ` DETACH PARTITION ` + def,
+		create,
+		`WITH "moved" AS (DELETE FROM ` + def + ` WHERE "time" >= ` + lower + ` AND "time" < ` + upper + ` RETURNING *)
+		INSERT INTO ` + table + ` SELECT * FROM "moved"`,
+		`ALTER TABLE ` + table + ` ATTACH PARTITION ` + def + ` DEFAULT`,
+	} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partition return quoted name of partition in the schema of the table
+func (d DriverPostgres) partition(name string) string {
+	return identifier{d.table().schema, name}.quoted()
+}
+
+// StartMaintenance run Maintain every interval until the context is done. Errors are passed to onError, it may be nil
+func (d DriverPostgres) StartMaintenance(ctx context.Context, interval time.Duration, onError func(error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := d.Maintain(ctx, now); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// RemoveOlderThan remove logs which are started before the time. Logs are removed by batches (see Params.RemoveBatch),
+// so the table is not locked for long time
+func (d DriverPostgres) RemoveOlderThan(ctx context.Context, t time.Time) (tracefall.ResponseCmd, error) {
+	resp := tracefall.NewResponse(t)
+
+	if err := d.removeBefore(ctx, d.table().quoted(), t); err != nil {
+		return *resp.SetError(err).ToCmd(), err
+	}
+
+	return *resp.Success().ToCmd(), nil
+}
+
+// removeBefore remove logs of the table or its partition which are started before the time. Logs are removed by batches
+func (d DriverPostgres) removeBefore(ctx context.Context, from string, t time.Time) error {
+	batch := d.params.RemoveBatch
+	if batch <= 0 {
+		batch = DefaultRemoveBatch
+	}
+
+	where := `"id" IN (SELECT "id" FROM ` + from + ` WHERE "time" < $1 LIMIT $2)`
+
+	for {
+		n, err := d.remove(ctx, where, t.UnixNano(), batch)
+		if err != nil {
+			return err
+		}
+		if n < int64(batch) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efureev/tracefall"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPartitioning(t *testing.T) {
+	// Thursday
+	now := time.Date(2019, 1, 31, 15, 4, 5, 0, time.UTC)
+
+	Convey("Partitioning", t, func() {
+		So(PartitionDaily.start(now), ShouldEqual, time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC))
+		So(PartitionDaily.next(PartitionDaily.start(now)), ShouldEqual, time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC))
+		So(PartitionWeekly.start(now), ShouldEqual, time.Date(2019, 1, 28, 0, 0, 0, 0, time.UTC))
+		So(PartitionWeekly.start(time.Date(2019, 2, 3, 23, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2019, 1, 28, 0, 0, 0, 0, time.UTC))
+		So(PartitionWeekly.next(PartitionWeekly.start(now)), ShouldEqual, time.Date(2019, 2, 4, 0, 0, 0, 0, time.UTC))
+
+		So(PartitionDaily.name(`tracer`, PartitionDaily.start(now)), ShouldEqual, `tracer_d20190131`)
+		So(PartitionWeekly.name(`tracer`, PartitionWeekly.start(now)), ShouldEqual, `tracer_w20190128`)
+
+		start, ok := PartitionDaily.parse(`tracer`, `tracer_d20190131`)
+		So(ok, ShouldBeTrue)
+		So(start, ShouldEqual, time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC))
+
+		for _, name := range []string{`tracer_default`, `tracer_w20190128`, `tracer_d2019013`, `other_d20190131`, `tracer_dxxxxxxxx`} {
+			_, ok := PartitionDaily.parse(`tracer`, name)
+			So(ok, ShouldBeFalse)
+		}
+		_, ok = PartitionWeekly.parse(`tracer`, `tracer_w20190129`)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Plan", t, func() {
+		d := DriverPostgres{params: Params{TableName: `tracer`, Partition: PartitionDaily, PartitionsAhead: 2, RetentionDays: 3}}
+
+		plan := d.plan(now, []string{`tracer_default`, `tracer_d20190127`, `tracer_d20190128`, `tracer_d20190129`, `tracer_d20190131`})
+
+		So(plan.create, ShouldResemble, []time.Time{
+			time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2019, 2, 2, 0, 0, 0, 0, time.UTC),
+		})
+		So(plan.drop, ShouldResemble, []string{`tracer_d20190127`})
+
+		Convey("Without retention", func() {
+			d.params.RetentionDays = 0
+			So(d.plan(now, []string{`tracer_d20100101`}).drop, ShouldBeEmpty)
+		})
+
+		Convey("Weekly", func() {
+			d.params.Partition = PartitionWeekly
+			d.params.RetentionDays = 10
+
+			plan := d.plan(now, []string{`tracer_w20190114`, `tracer_w20190121`})
+			So(plan.create, ShouldHaveLength, 3)
+			So(plan.create[0], ShouldEqual, time.Date(2019, 1, 28, 0, 0, 0, 0, time.UTC))
+			So(plan.drop, ShouldResemble, []string{`tracer_w20190114`})
+		})
+	})
+
+	Convey("Params", t, func() {
+		var p Params
+		params := GetConnParams(`localhost`, `db`, `tracer`, `user`, ``)
+
+		So(p.set(params), ShouldBeNil)
+		So(p.Partition, ShouldEqual, PartitionNone)
+		So(p.PartitionsAhead, ShouldEqual, DefaultPartitionsAhead)
+		So(p.RemoveBatch, ShouldEqual, DefaultRemoveBatch)
+		So(p.RetentionDays, ShouldEqual, 0)
+
+		params[`partition`] = `weekly`
+		params[`retention`] = `30`
+		params[`batch`] = `500`
+		So(p.set(params), ShouldBeNil)
+		So(p.Partition, ShouldEqual, PartitionWeekly)
+		So(p.RetentionDays, ShouldEqual, 30)
+		So(p.RemoveBatch, ShouldEqual, 500)
+
+		params[`partition`] = `monthly`
+		So(p.set(params), ShouldBeError)
+
+		params[`partition`] = `daily`
+		params[`retention`] = `-1`
+		So(p.set(params), ShouldBeError)
+	})
+
+	Convey("Partitioning queries", t, func() {
+		d := DriverPostgres{params: Params{TableName: `logs.tracer`}}
+
+		up := strings.Join(d.partitioningQuery(true), ";\n")
+		So(up, ShouldContainSubstring, `ALTER TABLE "logs"."tracer" RENAME TO "tracer_unpartitioned"`)
+		So(up, ShouldContainSubstring, `CREATE TABLE "logs"."tracer" (LIKE "logs"."tracer_unpartitioned" INCLUDING DEFAULTS) PARTITION BY RANGE ("time")`)
+		So(up, ShouldContainSubstring, `CREATE TABLE "logs"."tracer_default" PARTITION OF "logs"."tracer" DEFAULT`)
+		So(up, ShouldContainSubstring, `INSERT INTO "logs"."tracer" SELECT * FROM "logs"."tracer_unpartitioned"`)
+		So(up, ShouldContainSubstring, `ALTER TABLE "logs"."tracer" ADD PRIMARY KEY ("id", "time")`)
+		So(up, ShouldContainSubstring, `CREATE INDEX "tracer_status_idx" ON "logs"."tracer" USING btree ("status")`)
+		So(up, ShouldContainSubstring, `CREATE INDEX "tracer_tags_idx" ON "logs"."tracer" USING gin ("tags")`)
+
+		down := strings.Join(d.partitioningQuery(false), ";\n")
+		So(down, ShouldContainSubstring, `ALTER TABLE "logs"."tracer" RENAME TO "tracer_partitioned"`)
+		So(down, ShouldContainSubstring, `CREATE TABLE "logs"."tracer" (LIKE "logs"."tracer_partitioned" INCLUDING DEFAULTS);`)
+		So(down, ShouldNotContainSubstring, `DEFAULT;`)
+		So(down, ShouldContainSubstring, `ALTER TABLE "logs"."tracer" ADD PRIMARY KEY ("id")`)
+		So(down, ShouldContainSubstring, `DROP TABLE "logs"."tracer_partitioned"`)
+	})
+}
+
+func TestPartitionMaintenance(t *testing.T) {
+	Convey("Partitioned table", t, func() {
+		params := rightConnParams()
+		params[`table`] = params[`table`] + `_partitioned`
+		params[`partition`] = string(PartitionDaily)
+		params[`retention`] = `2`
+
+		db, err := tracefall.Open(`postgres`, params)
+		So(err, ShouldBeNil)
+		d := db.Driver().(*DriverPostgres)
+		defer d.DropTable()
+
+		l := tracefall.NewLog(`partitioned`)
+		_, err = db.Send(l)
+		So(err, ShouldBeNil)
+
+		// out of created partitions: it goes to the default partition
+		future := tracefall.NewLog(`future`)
+		future.Time = time.Now().AddDate(0, 0, 5)
+		_, err = db.Send(future)
+		So(err, ShouldBeNil)
+
+		old := tracefall.NewLog(`old`)
+		old.Time = time.Now().AddDate(0, 0, -10)
+		_, err = db.Send(old)
+		So(err, ShouldBeNil)
+
+		So(d.Maintain(context.Background(), time.Now().AddDate(0, 0, 5)), ShouldBeNil)
+
+		resp, err := db.GetLog(l.ID)
+		So(err, ShouldBeError)
+		So(resp.Log, ShouldBeNil)
+
+		resp, err = db.GetLog(future.ID)
+		So(err, ShouldBeNil)
+		So(resp.Log.Name, ShouldEqual, `future`)
+
+		_, err = db.GetLog(old.ID)
+		So(err, ShouldBeError)
+	})
+
+	Convey("Remove older than", t, func() {
+		db, err := tracefall.Open(`postgres`, rightConnParams())
+		So(err, ShouldBeNil)
+
+		l := tracefall.NewLog(`old`)
+		_, err = db.Send(l)
+		So(err, ShouldBeNil)
+
+		resp, err := db.Driver().(*DriverPostgres).RemoveOlderThan(context.Background(), time.Now().Add(time.Second))
+		So(err, ShouldBeNil)
+		So(resp.Result, ShouldBeTrue)
+
+		_, err = db.GetLog(l.ID)
+		So(err, ShouldBeError)
+	})
+}
@@ -40,15 +40,12 @@ func rightConnParams() map[string]string {
 func TestPostgresDriverOpen(t *testing.T) {
 	Convey("Postgres Driver Tests", t, func() {
 		Convey("Open wrong db", func() {
-			So(func() {
-				params := GetConnParams("localhost:5432", "postgres", "tracerFake", `root`, ``)
-				tracefall.Open(`postgres`, params)
-			}, ShouldPanic)
-
-			So(func() {
-				params := GetConnParams("localhost:54321", "postgres", "tracer", `postgres`, `postgres`)
-				tracefall.Open(`postgres`, params)
-			}, ShouldPanic)
+			_, err := tracefall.Open(`postgres`, GetConnParams("localhost:5432", "postgres", "tracerFake", `root`, ``))
+			So(err, ShouldBeError)
+
+			_, err = tracefall.Open(`postgres`, GetConnParams("localhost:54321", "postgres", "tracer", `postgres`, `postgres`))
+			So(err, ShouldBeError)
+			So(err.Error(), ShouldContainSubstring, `couldn't ping postgres database (postgres)`)
 		})
 
 		Convey("Open Instance", func() {
@@ -112,11 +109,10 @@ func TestPostgresDriverCreateAndDrop(t *testing.T) {
 		l2, err := l.CreateChild(`Test2`)
 		So(err, ShouldBeNil)
 
-		l2.SetEnvironment(`prod`).Success().ThreadFinish().Tags.Add(`child`)
-		l2.Notes.Add(`step`, `note1`).
-			Add(`step`, `note2`).
-			Add(`id`, l.ID.String())
-		l2.Data.Set(`thread`, `thread: `+l.Thread.String())
+		l2.SetEnvironment(`prod`).Success().ThreadFinish().AddTag(`child`)
+		l2.AddNotes(`step`, `note1`, `note2`).
+			AddNotes(`id`, l.ID.String())
+		l2.SetData(`thread`, `thread: `+l.Thread.String())
 
 		resp2, err := db.Send(l2)
 
@@ -138,6 +134,11 @@ func TestPostgresDriverCreateAndDrop(t *testing.T) {
 		So(lGet.Log.ID.String(), ShouldEqual, l.ID.String())
 		So(l.Environment, ShouldEqual, tracefall.EnvironmentDev)
 
+		// order of note groups survives jsonb
+		l2Get, err := db.GetLog(l2.ID)
+		So(err, ShouldBeNil)
+		So(l2Get.Log.Notes, ShouldResemble, l2.ToLogJSON().Notes)
+
 		// fail
 		uid, _ := uuid.NewV4()
 		lGetFail, err2 := db.GetLog(uid)
@@ -200,10 +201,10 @@ func TestPostgresDriverGetter(t *testing.T) {
 
 			l2, err := l.CreateChild(`Child`)
 			So(err, ShouldBeNil)
-			l2.SetEnvironment(`prod`).Success().ThreadFinish().Tags.Add(`child`)
-			l2.Notes.Add(`step`, `note1`).Add(`step`, `note2`)
-			l2.Data.Set(`id`, l2.ID).
-				Set(`thread`, `thread: `+l2.Thread.String())
+			l2.SetEnvironment(`prod`).Success().ThreadFinish().AddTag(`child`)
+			l2.AddNotes(`step`, `note1`).AddNotes(`step`, `note2`)
+			l2.SetData(`id`, l2.ID).
+				SetData(`thread`, `thread: `+l2.Thread.String())
 
 			resp2, err := db.Send(l2)
 			So(err, ShouldBeNil)
@@ -214,9 +215,9 @@ func TestPostgresDriverGetter(t *testing.T) {
 			l3, err := l.CreateChild(`Child`)
 			So(err, ShouldBeNil)
 
-			l3.Success().Tags.
-				Add(`child`).Add(`2`)
-			l3.Data.Set(`step`, `note1`).Set(`id`, l3.ID)
+			l3.Success().
+				AddTag(`child`).AddTag(`2`)
+			l3.SetData(`step`, `note1`).SetData(`id`, l3.ID)
 
 			resp3, err := db.Send(l3)
 
@@ -228,7 +229,7 @@ func TestPostgresDriverGetter(t *testing.T) {
 			l4, err := l3.CreateChild(`SubChild of Child`)
 			So(err, ShouldBeNil)
 
-			l4.Success().ThreadFinish().Tags.Add(`child`)
+			l4.Success().ThreadFinish().AddTag(`child`)
 
 			resp4, err := db.Send(l4)
 
@@ -248,6 +249,7 @@ func TestPostgresDriverGetter(t *testing.T) {
 				So(logRootGet.Parent, ShouldBeNil)
 				So(logRootGet.Time, ShouldEqual, l.Time.UnixNano())
 				So(logRootGet.TimeEnd, ShouldBeNil)
+				So(logRootGet.Duration, ShouldBeNil)
 				So(logRootGet.Error, ShouldEqual, l.Error)
 				So(logRootGet.App, ShouldEqual, l.App)
 				So(logRootGet.Name, ShouldEqual, l.Name)
@@ -255,7 +257,9 @@ func TestPostgresDriverGetter(t *testing.T) {
 				So(logRootGet.ID.String(), ShouldEqual, l.ID.String())
 				So(logRootGet.Finish, ShouldEqual, l.Finish)
 				So(logRootGet.Result, ShouldEqual, l.Result)
-				So(logRootGet.Tags, ShouldResemble, l.Tags.List())
+				So(logRootGet.Status, ShouldEqual, tracefall.StatusPending)
+				So(logRootGet.Tags, ShouldResemble, l.Tags().List())
+				So(logRootGet.Resource, ShouldResemble, l.Resource)
 
 				l2Get, err := db.GetLog(l2.ID)
 				So(err, ShouldBeNil)
@@ -267,12 +271,14 @@ func TestPostgresDriverGetter(t *testing.T) {
 				So(*log2Get.Parent, ShouldEqual, logRootGet.ID.String())
 				So(log2Get.Time, ShouldEqual, l2.Time.UnixNano())
 				So(*log2Get.TimeEnd, ShouldEqual, l2.TimeEnd.UnixNano())
+				So(*log2Get.Duration, ShouldEqual, l2.Duration().Nanoseconds())
 				So(log2Get.App, ShouldEqual, l2.App)
 				So(log2Get.Name, ShouldEqual, l2.Name)
 				So(log2Get.Environment, ShouldEqual, l2.Environment)
 				So(log2Get.Finish, ShouldEqual, l2.Finish)
 				So(log2Get.Result, ShouldEqual, l2.Result)
-				So(log2Get.Tags, ShouldResemble, l2.Tags.List())
+				So(log2Get.Status, ShouldEqual, tracefall.StatusSuccess)
+				So(log2Get.Tags, ShouldResemble, l2.Tags().List())
 
 				l3Get, err := db.GetLog(l3.ID)
 				So(err, ShouldBeNil)
@@ -290,7 +296,7 @@ func TestPostgresDriverGetter(t *testing.T) {
 				So(log3Get.Environment, ShouldEqual, l3.Environment)
 				So(log3Get.Finish, ShouldEqual, l3.Finish)
 				So(log3Get.Result, ShouldEqual, l3.Result)
-				So(log3Get.Tags, ShouldResemble, l3.Tags.List())
+				So(log3Get.Tags, ShouldResemble, l3.Tags().List())
 
 				l4Get, err := db.GetLog(l4.ID)
 				So(err, ShouldBeNil)
@@ -308,7 +314,7 @@ func TestPostgresDriverGetter(t *testing.T) {
 				So(log4Get.Environment, ShouldEqual, l4.Environment)
 				So(log4Get.Finish, ShouldEqual, l4.Finish)
 				So(log4Get.Result, ShouldEqual, l4.Result)
-				So(log4Get.Tags, ShouldResemble, l4.Tags.List())
+				So(log4Get.Tags, ShouldResemble, l4.Tags().List())
 
 				lThreadResp, err := db.GetThread(l4.Thread)
 				So(err, ShouldBeNil)
@@ -321,6 +327,13 @@ func TestPostgresDriverGetter(t *testing.T) {
 					So(v, ShouldHaveSameTypeAs, &tracefall.LogJSON{})
 				}
 
+				pending, err := db.Driver().(*DriverPostgres).GetLastListByStatus(10, tracefall.StatusPending)
+				So(err, ShouldBeNil)
+				So(len(pending), ShouldBeGreaterThan, 0)
+				for _, v := range pending {
+					So(v.Status, ShouldEqual, tracefall.StatusPending)
+				}
+
 				respRemove, err := db.RemoveThread(l4.Thread)
 				So(err, ShouldBeNil)
 				So(respRemove.Error, ShouldBeNil)
@@ -0,0 +1,75 @@
+package tracefall
+
+import (
+	"sync"
+	"time"
+)
+
+// Stopwatch measures elapsed time by the monotonic clock
+type Stopwatch struct {
+	mu    sync.Mutex
+	start time.Time
+	stop  *time.Time
+}
+
+// NewStopwatch create new started Stopwatch
+func NewStopwatch() *Stopwatch {
+	return &Stopwatch{start: time.Now()}
+}
+
+// Elapsed return time passed since start until now or until stop of the stopwatch
+func (s *Stopwatch) Elapsed() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		return s.stop.Sub(s.start)
+	}
+	return time.Since(s.start)
+}
+
+// Stop stop the stopwatch and return elapsed time. Repeated calls return the same value
+func (s *Stopwatch) Stop() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop == nil {
+		n := time.Now()
+		s.stop = &n
+	}
+	return s.stop.Sub(s.start)
+}
+
+// Restart start the stopwatch again
+func (s *Stopwatch) Restart() *Stopwatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.start = time.Now()
+	s.stop = nil
+	return s
+}
+
+// Measure create child log, run fn and finish the child: Success if fn return nil, Fail otherwise.
+// Panic of fn fails the child as Log.Recover does, then PanicError is returned (or the panic is raised again, see SetRepanic).
+// Return the child, which is to be sent, and error of fn. Fn is not run if the child can not be created
+func (l *Log) Measure(name string, fn func() error) (child *Log, err error) {
+	child, err = l.CreateChild(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = child.recovered(rec)
+		}
+	}()
+
+	if err = fn(); err != nil {
+		child.Fail(err)
+		return child, err
+	}
+
+	child.Success()
+	return child, nil
+}
@@ -0,0 +1,127 @@
+package tracefall
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDuration(t *testing.T) {
+
+	Convey("Log Duration", t, func() {
+		l := NewLog(`root`)
+
+		So(l.Duration(), ShouldBeGreaterThanOrEqualTo, 0)
+		So(l.ToLogJSON().Duration, ShouldBeNil)
+
+		time.Sleep(time.Millisecond)
+		l.Success()
+
+		d := l.Duration()
+		So(d, ShouldBeGreaterThanOrEqualTo, time.Millisecond)
+		So(l.Duration(), ShouldEqual, d)
+		So(l.Snapshot().Duration(), ShouldEqual, d)
+
+		lj := l.ToLogJSON()
+		So(lj.Duration, ShouldNotBeNil)
+		So(*lj.Duration, ShouldEqual, int64(d))
+
+		Convey("Duration is kept by JSON", func() {
+			// wall clock of restored log is different from the measured duration
+			*lj.TimeEnd += int64(time.Hour)
+
+			restored, err := lj.ToLog()
+			So(err, ShouldBeNil)
+			So(restored.Duration(), ShouldEqual, d)
+
+			var fromJSON Log
+			So(json.Unmarshal(l.ToJSON(), &fromJSON), ShouldBeNil)
+			So(fromJSON.Duration(), ShouldEqual, d)
+
+			fromJSON.Success()
+			So(fromJSON.Duration(), ShouldEqual, fromJSON.TimeEnd.Sub(fromJSON.Time))
+		})
+
+		Convey("Duration of JSON without it", func() {
+			lj.Duration = nil
+
+			restored, err := lj.ToLog()
+			So(err, ShouldBeNil)
+			So(int64(restored.Duration()), ShouldEqual, *lj.TimeEnd-lj.Time)
+		})
+	})
+
+	Convey("Stopwatch", t, func() {
+		s := NewStopwatch()
+		time.Sleep(time.Millisecond)
+
+		So(s.Elapsed(), ShouldBeGreaterThanOrEqualTo, time.Millisecond)
+
+		d := s.Stop()
+		So(d, ShouldBeGreaterThanOrEqualTo, time.Millisecond)
+		So(s.Stop(), ShouldEqual, d)
+		So(s.Elapsed(), ShouldEqual, d)
+
+		So(s.Restart().Elapsed(), ShouldBeLessThan, d)
+	})
+
+	Convey("Measure", t, func() {
+		root := NewLog(`root`)
+
+		Convey("Success", func() {
+			child, err := root.Measure(`step`, func() error {
+				time.Sleep(time.Millisecond)
+				return nil
+			})
+
+			So(err, ShouldBeNil)
+			So(child.Name, ShouldEqual, `step`)
+			So(child.Parent, ShouldEqual, root)
+			So(child.Result, ShouldBeTrue)
+			So(child.TimeEnd, ShouldNotBeNil)
+			So(child.Duration(), ShouldBeGreaterThanOrEqualTo, time.Millisecond)
+		})
+
+		Convey("Fail", func() {
+			e := errors.New(`failed`)
+			child, err := root.Measure(`step`, func() error { return e })
+
+			So(err, ShouldEqual, e)
+			So(child.Result, ShouldBeFalse)
+			So(child.Error, ShouldEqual, e)
+			So(child.TimeEnd, ShouldNotBeNil)
+		})
+
+		Convey("Panic", func() {
+			child, err := root.Measure(`step`, func() error { panic(`boom`) })
+
+			So(err, ShouldHaveSameTypeAs, &PanicError{})
+			So(err.Error(), ShouldEqual, `panic: boom`)
+			So(child.Result, ShouldBeFalse)
+			So(child.TimeEnd, ShouldNotBeNil)
+			So(child.ErrorInfo.Stack[0], ShouldContainSubstring, `duration_test.go`)
+
+			SetRepanic(true)
+			defer SetRepanic(false)
+
+			var panicked *Log
+			So(func() {
+				panicked, _ = root.Measure(`step`, func() error { panic(`again`) })
+			}, ShouldPanicWith, `again`)
+			So(panicked, ShouldBeNil)
+		})
+
+		Convey("Finished parent", func() {
+			called := false
+			root.ThreadFinish()
+			child, err := root.Measure(`step`, func() error { called = true; return nil })
+
+			So(err, ShouldEqual, ErrorParentFinish)
+			So(child, ShouldBeNil)
+			So(called, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,178 @@
+package tracefall
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// maxStackDepth is limit of frames of captured stack
+const maxStackDepth = 64
+
+// ErrorInfo is structured error of the log: message, type, chain of wrapped errors and stack trace.
+// It is restored from plain string too, so logs which were stored with `"error":"message"` are still readable
+type ErrorInfo struct {
+	Message string       `json:"message"`
+	Type    string       `json:"type,omitempty"`
+	Chain   []ErrorCause `json:"chain,omitempty"`
+	Stack   []string     `json:"stack,omitempty"`
+	Panic   bool         `json:"panic,omitempty"`
+}
+
+// ErrorCause is wrapped error of ErrorInfo chain
+type ErrorCause struct {
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"`
+}
+
+// NewErrorInfo create ErrorInfo of the error: its type and chain of wrapped errors. Return nil for nil error
+func NewErrorInfo(err error) *ErrorInfo {
+	if err == nil {
+		return nil
+	}
+	if info, ok := err.(*ErrorInfo); ok {
+		return info.Copy()
+	}
+
+	info := &ErrorInfo{Message: err.Error(), Type: errorType(err)}
+	for _, cause := range unwrapAll(err) {
+		info.Chain = append(info.Chain, ErrorCause{cause.Error(), errorType(cause)})
+	}
+	_, info.Panic = err.(*PanicError)
+
+	return info
+}
+
+// Error implements error, so ErrorInfo of restored log is its Error
+func (e *ErrorInfo) Error() string {
+	return e.Message
+}
+
+// Copy return copy of ErrorInfo
+func (e *ErrorInfo) Copy() *ErrorInfo {
+	if e == nil {
+		return nil
+	}
+	c := *e
+	c.Chain = append([]ErrorCause(nil), e.Chain...)
+	c.Stack = append([]string(nil), e.Stack...)
+	return &c
+}
+
+// CaptureStack set stack of the caller. The argument skip is the number of stack frames to ascend,
+// with 0 identifying the caller of CaptureStack. Leading frames of runtime (panicking) are skipped
+func (e *ErrorInfo) CaptureStack(skip int) *ErrorInfo {
+	pc := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip+2, pc)
+
+	e.Stack = e.Stack[:0]
+	frames := runtime.CallersFrames(pc[:n])
+	for {
+		frame, more := frames.Next()
+		if len(e.Stack) > 0 || !strings.HasPrefix(frame.Function, `runtime.`) {
+			e.Stack = append(e.Stack, fmt.Sprintf(`%s %s:%d`, frame.Function, frame.File, frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return e
+}
+
+// UnmarshalJSON restore ErrorInfo from object or plain string
+func (e *ErrorInfo) UnmarshalJSON(b []byte) error {
+	var msg string
+	if err := json.Unmarshal(b, &msg); err == nil {
+		*e = ErrorInfo{Message: msg}
+		return nil
+	}
+
+	type plain ErrorInfo
+	return json.Unmarshal(b, (*plain)(e))
+}
+
+// errorType return type name of the error: `*fs.PathError`
+func errorType(err error) string {
+	return fmt.Sprintf(`%T`, err)
+}
+
+// unwrapAll return wrapped errors of the error in depth-first order. Errors joined by errors.Join are walked too
+func unwrapAll(err error) []error {
+	var res []error
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		if cause := e.Unwrap(); cause != nil {
+			res = append(res, cause)
+			res = append(res, unwrapAll(cause)...)
+		}
+	case interface{ Unwrap() []error }:
+		for _, cause := range e.Unwrap() {
+			if cause != nil {
+				res = append(res, cause)
+				res = append(res, unwrapAll(cause)...)
+			}
+		}
+	}
+	return res
+}
+
+var errorStack int32
+
+// SetErrorStack turn on (or off) capturing of stack trace by Log.Fail
+func SetErrorStack(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&errorStack, v)
+}
+
+// PanicError is error of the panic which is recovered by Log.Recover
+type PanicError struct {
+	Value interface{}
+}
+
+// Error implements error
+func (e *PanicError) Error() string {
+	return fmt.Sprintf(`panic: %v`, e.Value)
+}
+
+// Unwrap return value of the panic if it is error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+var repanic int32
+
+// SetRepanic turn on (or off) panicking again by Log.Recover after the log is failed
+func SetRepanic(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&repanic, v)
+}
+
+// Recover fail the log by recovered panic with its stack trace. It has to be deferred: `defer log.Recover()`.
+// The panic is raised again if it is turned on by SetRepanic
+func (l *Log) Recover() {
+	l.recovered(recover())
+}
+
+// recovered fail the log by the recovered value and return PanicError of it. Nil value is not a panic: nil is returned
+func (l *Log) recovered(rec interface{}) error {
+	if rec == nil {
+		return nil
+	}
+
+	err := &PanicError{Value: rec}
+	l.fail(err, NewErrorInfo(err).CaptureStack(2))
+
+	if atomic.LoadInt32(&repanic) == 1 {
+		panic(rec)
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+package tracefall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestErrorInfo(t *testing.T) {
+
+	Convey("Error Info", t, func() {
+		So(NewErrorInfo(nil), ShouldBeNil)
+
+		_, pathErr := os.Open(`/absent/file`)
+		err := fmt.Errorf(`load config: %w`, pathErr)
+
+		info := NewErrorInfo(err)
+		So(info.Message, ShouldEqual, err.Error())
+		So(info.Error(), ShouldEqual, err.Error())
+		So(info.Type, ShouldEqual, `*fmt.wrapError`)
+		So(info.Chain, ShouldHaveLength, 2)
+		So(info.Chain[0], ShouldResemble, ErrorCause{pathErr.Error(), `*fs.PathError`})
+		So(info.Chain[1].Type, ShouldEqual, `syscall.Errno`)
+		So(info.Stack, ShouldBeEmpty)
+		So(info.Panic, ShouldBeFalse)
+
+		So(NewErrorInfo(info), ShouldResemble, info)
+		So(NewErrorInfo(info), ShouldNotPointTo, info)
+
+		Convey("Joined errors", func() {
+			info := NewErrorInfo(errors.Join(errors.New(`first`), errors.New(`second`)))
+
+			So(info.Chain, ShouldHaveLength, 2)
+			So(info.Chain[0].Message, ShouldEqual, `first`)
+			So(info.Chain[1].Message, ShouldEqual, `second`)
+		})
+
+		Convey("Stack", func() {
+			info := NewErrorInfo(err).CaptureStack(0)
+
+			So(info.Stack, ShouldNotBeEmpty)
+			So(info.Stack[0], ShouldStartWith, `github.com/efureev/tracefall.TestErrorInfo`)
+			So(info.Stack[0], ShouldContainSubstring, `errorInfo_test.go:`)
+
+			c := info.Copy()
+			c.Stack[0] = `changed`
+			So(info.Stack[0], ShouldNotEqual, `changed`)
+		})
+
+		Convey("JSON", func() {
+			var restored ErrorInfo
+			So(json.Unmarshal([]byte(`"plain error"`), &restored), ShouldBeNil)
+			So(restored, ShouldResemble, ErrorInfo{Message: `plain error`})
+
+			b, e := json.Marshal(info)
+			So(e, ShouldBeNil)
+			So(json.Unmarshal(b, &restored), ShouldBeNil)
+			So(&restored, ShouldResemble, info)
+		})
+	})
+
+	Convey("Log Fail", t, func() {
+		l := NewLog(`log`)
+
+		Convey("Without stack", func() {
+			err := fmt.Errorf(`wrapped: %w`, errors.New(`cause`))
+			l.Fail(err)
+
+			So(l.Error, ShouldEqual, err)
+			So(l.ErrorInfo.Type, ShouldEqual, `*fmt.wrapError`)
+			So(l.ErrorInfo.Chain, ShouldHaveLength, 1)
+			So(l.ErrorInfo.Stack, ShouldBeEmpty)
+
+			lj := l.ToLogJSON()
+			So(lj.Error, ShouldResemble, l.ErrorInfo)
+
+			restored, e := lj.ToLog()
+			So(e, ShouldBeNil)
+			So(restored.Error.Error(), ShouldEqual, err.Error())
+			So(restored.ErrorInfo, ShouldResemble, l.ErrorInfo)
+			So(restored.ToLogJSON().Error, ShouldResemble, l.ErrorInfo)
+		})
+
+		Convey("With stack", func() {
+			SetErrorStack(true)
+			defer SetErrorStack(false)
+
+			l.Fail(errors.New(`fail`))
+
+			So(l.ErrorInfo.Stack, ShouldNotBeEmpty)
+			So(l.ErrorInfo.Stack[0], ShouldContainSubstring, `errorInfo_test.go:`)
+		})
+
+		Convey("Error set directly", func() {
+			l.Fail(errors.New(`fail`))
+			l.Error = errors.New(`other`)
+
+			So(l.GetErrorInfo().Message, ShouldEqual, `other`)
+		})
+
+		Convey("Old JSON with plain error", func() {
+			var restored Log
+			So(json.Unmarshal([]byte(`{"id":"`+l.ID.String()+`","error":"old error"}`), &restored), ShouldBeNil)
+			So(restored.Error.Error(), ShouldEqual, `old error`)
+			So(restored.ErrorInfo.Message, ShouldEqual, `old error`)
+		})
+	})
+
+	Convey("Log Recover", t, func() {
+		l := NewLog(`log`)
+
+		func() {
+			defer l.Recover()
+			panic(`boom`)
+		}()
+
+		So(l.Result, ShouldBeFalse)
+		So(l.TimeEnd, ShouldNotBeNil)
+		So(l.Error, ShouldHaveSameTypeAs, &PanicError{})
+		So(l.Error.Error(), ShouldEqual, `panic: boom`)
+		So(l.ErrorInfo.Panic, ShouldBeTrue)
+		So(l.ErrorInfo.Stack, ShouldNotBeEmpty)
+		So(strings.Join(l.ErrorInfo.Stack, "\n"), ShouldContainSubstring, `errorInfo_test.go:`)
+		So(l.ErrorInfo.Stack[0], ShouldNotStartWith, `runtime.`)
+
+		Convey("Panic by error", func() {
+			e := errors.New(`cause`)
+			func() {
+				defer l.Recover()
+				panic(e)
+			}()
+
+			So(errors.Is(l.Error, e), ShouldBeTrue)
+			So(l.ErrorInfo.Chain[0].Message, ShouldEqual, `cause`)
+		})
+
+		Convey("Without panic", func() {
+			l := NewLog(`log`)
+			func() {
+				defer l.Recover()
+			}()
+
+			So(l.TimeEnd, ShouldBeNil)
+			So(l.Error, ShouldBeNil)
+		})
+
+		Convey("Repanic", func() {
+			SetRepanic(true)
+			defer SetRepanic(false)
+
+			So(func() {
+				defer l.Recover()
+				panic(`boom`)
+			}, ShouldPanicWith, `boom`)
+			So(l.ErrorInfo.Panic, ShouldBeTrue)
+		})
+	})
+}
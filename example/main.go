@@ -63,8 +63,8 @@ func listen() {
 
 func runWork() {
 	logParent := tracefall.NewLog(`Start`).SetApplication(`micro#1`)
-	logParent.Success().Data.Set(`key1`, `zvalue`)
-	logParent.Tags.Add(`micro1`).Add(`root`)
+	logParent.Success().SetData(`key1`, `zvalue`)
+	logParent.AddTag(`micro1`).AddTag(`root`)
 
 	X.ToTraceLog <- logParent
 
@@ -80,17 +80,17 @@ func runWork() {
 			logChildren.Success()
 		}
 
-		logChildren.Notes.
-			AddGroup(`proc 1`, []string{`step one`, `step two`}).
-			Add(`proc 1`, `step three`).
-			Add(`proc 2`, `finally`)
+		logChildren.
+			AddNotes(`proc 1`, `step one`, `step two`).
+			AddNotes(`proc 1`, `step three`).
+			AddNotes(`proc 2`, `finally`)
 
 		X.ToTraceLog <- logChildren
 		shadow := logChildren.ToShadow()
 
 		// new log form other service:
 		logOther := tracefall.NewLog(`Resulting`).SetApplication(`micro#2`)
-		logOther.Tags.Add(`micro2`).Add(`finish`)
+		logOther.AddTag(`micro2`).AddTag(`finish`)
 		logOther.ParentFromShadow(shadow).Success().ThreadFinish()
 		X.ToTraceLog <- logOther
 	}
@@ -1,15 +1,46 @@
 package tracefall
 
 import (
+	"bytes"
 	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-// ExtraData is data tree
+// PathSeparator separates keys of nested maps in the data path: `http.request.method`
+const PathSeparator = `.`
+
+// ExtraData is data tree. It is not safe for concurrent use: data of Log is changed only by its methods (SetData, MergeData)
 type ExtraData map[string]interface{}
 
-// Set data by key
+// Set data by key. The key may be a path into nested maps: `http.request.method`.
+// Absent (or not map) nodes of the path are replaced by maps. Existing flat key with separator is updated as is
 func (e *ExtraData) Set(key string, val interface{}) *ExtraData {
-	(*e)[key] = val
+	if _, ok := (*e)[key]; ok || !strings.Contains(key, PathSeparator) {
+		(*e)[key] = val
+		return e
+	}
+
+	node := map[string]interface{}(*e)
+	path := strings.Split(key, PathSeparator)
+	for _, k := range path[:len(path)-1] {
+		switch next := node[k].(type) {
+		case map[string]interface{}:
+			node = next
+		case ExtraData:
+			node = next
+		default:
+			m := make(map[string]interface{})
+			node[k] = m
+			node = m
+		}
+	}
+	node[path[len(path)-1]] = val
+
 	return e
 }
 
@@ -19,26 +50,337 @@ func (e *ExtraData) Clear() *ExtraData {
 	return e
 }
 
-// Get return value by key
+// Get return value by key. The key may be a path into nested maps: `http.request.method`
 func (e ExtraData) Get(key string) interface{} {
 	if val, ok := e[key]; ok {
 		return val
 	}
-	return nil
+	if !strings.Contains(key, PathSeparator) {
+		return nil
+	}
+
+	var val interface{} = map[string]interface{}(e)
+	for _, k := range strings.Split(key, PathSeparator) {
+		switch node := val.(type) {
+		case map[string]interface{}:
+			val = node[k]
+		case ExtraData:
+			val = node[k]
+		default:
+			return nil
+		}
+	}
+	return val
+}
+
+// GetString return string value by key
+func (e ExtraData) GetString(key string) (string, bool) {
+	switch val := e.Get(key).(type) {
+	case string:
+		return val, true
+	case json.Number:
+		return val.String(), true
+	case []byte:
+		return string(val), true
+	default:
+		return ``, false
+	}
+}
+
+// GetInt return integer value by key. Floats without fractional part (numbers after json round trip),
+// json.Number and numeric strings are converted
+func (e ExtraData) GetInt(key string) (int64, bool) {
+	return toInt(e.Get(key))
+}
+
+// GetDuration return duration value by key. Integers are taken as nanoseconds, strings are parsed by time.ParseDuration
+func (e ExtraData) GetDuration(key string) (time.Duration, bool) {
+	val := e.Get(key)
+	switch v := val.(type) {
+	case time.Duration:
+		return v, true
+	case string:
+		d, err := time.ParseDuration(v)
+		return d, err == nil
+	}
+
+	i, ok := toInt(val)
+	return time.Duration(i), ok
+}
+
+// GetTime return time value by key. Strings are parsed as RFC3339, integers are taken as unix nanoseconds
+func (e ExtraData) GetTime(key string) (time.Time, bool) {
+	val := e.Get(key)
+	switch v := val.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v == nil {
+			return time.Time{}, false
+		}
+		return *v, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	}
+
+	if i, ok := toInt(val); ok {
+		return time.Unix(0, i), true
+	}
+	return time.Time{}, false
+}
+
+func toInt(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case float32:
+		return floatToInt(float64(v))
+	case float64:
+		return floatToInt(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, true
+		}
+		if f, err := v.Float64(); err == nil {
+			return floatToInt(f)
+		}
+		return 0, false
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func floatToInt(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// Merge copy values of other data into the data. Nested maps are merged, other values are replaced
+func (e *ExtraData) Merge(other ExtraData) *ExtraData {
+	src := other.Copy()
+
+	mergeMaps(*e, src)
+	return e
+}
+
+func mergeMaps(dst, src map[string]interface{}) {
+	for key, val := range src {
+		srcMap, ok := asMap(val)
+		if !ok {
+			dst[key] = val
+			continue
+		}
+
+		if dstMap, ok := asMap(dst[key]); ok {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+		dst[key] = val
+	}
+}
+
+func asMap(val interface{}) (map[string]interface{}, bool) {
+	switch m := val.(type) {
+	case map[string]interface{}:
+		return m, true
+	case ExtraData:
+		return m, m != nil
+	default:
+		return nil, false
+	}
+}
+
+// Len return count of keys
+func (e ExtraData) Len() int {
+	return len(e)
+}
+
+// Copy return deep copy of data
+func (e ExtraData) Copy() ExtraData {
+	if e == nil {
+		return nil
+	}
+	return copyValue(e).(ExtraData)
 }
 
 // ToJSON get json from data
 func (e ExtraData) ToJSON() []byte {
-	b, err := json.Marshal(e)
+	b, err := e.MarshalJSON()
 	if err != nil {
 		b = []byte(`{}`)
 	}
 	return b
 }
 
+// MarshalJSON marshal json. Values of types with registered encoders are encoded by them
+func (e ExtraData) MarshalJSON() ([]byte, error) {
+	if e == nil {
+		return []byte(`null`), nil
+	}
+	return json.Marshal(encodeValue(e.Copy()))
+}
+
 // FromJSON set data to struct from json
 func (e *ExtraData) FromJSON(b []byte) error {
-	return json.Unmarshal(b, e)
+	return e.UnmarshalJSON(b)
+}
+
+// UnmarshalJSON unmarshal json. Numbers are kept as json.Number, so integers are not converted to float64
+func (e *ExtraData) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode((*map[string]interface{})(e))
+}
+
+// DataEncoder convert value of registered type to value for json
+type DataEncoder func(val interface{}) interface{}
+
+var encoders = struct {
+	sync.RWMutex
+	m map[reflect.Type]DataEncoder
+}{m: make(map[reflect.Type]DataEncoder)}
+
+// RegisterDataEncoder set encoder for values of the sample type in ExtraData. Pointers to the type are encoded too
+func RegisterDataEncoder(sample interface{}, enc DataEncoder) {
+	encoders.Lock()
+	defer encoders.Unlock()
+
+	encoders.m[reflect.TypeOf(sample)] = enc
+}
+
+func encoderOf(val interface{}) (DataEncoder, interface{}) {
+	encoders.RLock()
+	defer encoders.RUnlock()
+
+	if len(encoders.m) == 0 || val == nil {
+		return nil, nil
+	}
+
+	if enc, ok := encoders.m[reflect.TypeOf(val)]; ok {
+		return enc, val
+	}
+
+	if rv := reflect.ValueOf(val); rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		if enc, ok := encoders.m[rv.Type().Elem()]; ok {
+			return enc, rv.Elem().Interface()
+		}
+	}
+	return nil, nil
+}
+
+// encodeValue replace values of registered types in data tree (which is owned by caller)
+func encodeValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case ExtraData:
+		return encodeValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = encodeValue(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = encodeValue(item)
+		}
+		return v
+	}
+
+	if enc, src := encoderOf(val); enc != nil {
+		return enc(src)
+	}
+	return val
+}
+
+// copyValue make deep copy of data trees: maps and slices, typed ones too (http.Header, map[string]string, []string).
+// Pointers and structs are not copied
+func copyValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[k] = copyValue(item)
+		}
+		return m
+	case ExtraData:
+		m := make(ExtraData, len(val))
+		for k, item := range val {
+			m[k] = copyValue(item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, item := range val {
+			list[i] = copyValue(item)
+		}
+		return list
+	case nil, string, bool, int, int64, float64, json.Number:
+		return v
+	default:
+		return copyReflect(reflect.ValueOf(v)).Interface()
+	}
+}
+
+// copyReflect make deep copy of typed maps and slices
+func copyReflect(rv reflect.Value) reflect.Value {
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.IsNil() {
+			return rv
+		}
+		m := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		for iter := rv.MapRange(); iter.Next(); {
+			m.SetMapIndex(iter.Key(), copyReflect(iter.Value()))
+		}
+		return m
+	case reflect.Slice:
+		if rv.IsNil() {
+			return rv
+		}
+		list := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		switch rv.Type().Elem().Kind() {
+		case reflect.Map, reflect.Slice, reflect.Interface:
+			for i := 0; i < rv.Len(); i++ {
+				list.Index(i).Set(copyReflect(rv.Index(i)))
+			}
+		default:
+			reflect.Copy(list, rv)
+		}
+		return list
+	case reflect.Interface:
+		if rv.IsNil() {
+			return rv
+		}
+		return copyReflect(rv.Elem())
+	default:
+		return rv
+	}
 }
 
 // NewExtraData create new Data struct
@@ -1,8 +1,12 @@
 package tracefall
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -44,5 +48,185 @@ func TestExtraParams(t *testing.T) {
 
 			So(string(params.ToJSON()), ShouldEqual, `{"dig":123,"test":"value"}`)
 		})
+
+		Convey("Path", func() {
+			params.Set(`http.request.method`, `GET`).Set(`http.request.url`, `/`).Set(`http.status`, 200)
+
+			So(params.Get(`http.request.method`), ShouldEqual, `GET`)
+			So(params.Get(`http.status`), ShouldEqual, 200)
+			So(params.Get(`http.request`), ShouldResemble, map[string]interface{}{`method`: `GET`, `url`: `/`})
+			So(params.Get(`http.status.code`), ShouldBeNil)
+			So(params.Get(`http.absent.method`), ShouldBeNil)
+			So(string(params.ToJSON()), ShouldEqual, `{"http":{"request":{"method":"GET","url":"/"},"status":200}}`)
+
+			params.Set(`http.status.code`, 200)
+			So(params.Get(`http.status`), ShouldResemble, map[string]interface{}{`code`: 200})
+
+			params[`flat.key`] = `flat`
+			params.Set(`flat.key`, `changed`)
+			So(params.Get(`flat.key`), ShouldEqual, `changed`)
+			So(params.Get(`flat`), ShouldBeNil)
+		})
+
+		Convey("Typed getters", func() {
+			now := time.Now()
+			params.
+				Set(`str`, `value`).
+				Set(`int`, 12).
+				Set(`float`, 12.0).
+				Set(`fraction`, 12.5).
+				Set(`number`, json.Number(`9007199254740993`)).
+				Set(`duration`, time.Second).
+				Set(`durationStr`, `1m`).
+				Set(`time`, now).
+				Set(`timeStr`, now.Format(time.RFC3339Nano))
+
+			str, ok := params.GetString(`str`)
+			So(ok, ShouldBeTrue)
+			So(str, ShouldEqual, `value`)
+			_, ok = params.GetString(`int`)
+			So(ok, ShouldBeFalse)
+
+			i, ok := params.GetInt(`int`)
+			So(ok, ShouldBeTrue)
+			So(i, ShouldEqual, 12)
+			i, ok = params.GetInt(`float`)
+			So(ok, ShouldBeTrue)
+			So(i, ShouldEqual, 12)
+			_, ok = params.GetInt(`fraction`)
+			So(ok, ShouldBeFalse)
+			i, ok = params.GetInt(`number`)
+			So(ok, ShouldBeTrue)
+			So(i, ShouldEqual, int64(9007199254740993))
+			_, ok = params.GetInt(`absent`)
+			So(ok, ShouldBeFalse)
+
+			d, ok := params.GetDuration(`duration`)
+			So(ok, ShouldBeTrue)
+			So(d, ShouldEqual, time.Second)
+			d, ok = params.GetDuration(`durationStr`)
+			So(ok, ShouldBeTrue)
+			So(d, ShouldEqual, time.Minute)
+			d, _ = params.GetDuration(`int`)
+			So(d, ShouldEqual, 12*time.Nanosecond)
+
+			tm, ok := params.GetTime(`time`)
+			So(ok, ShouldBeTrue)
+			So(tm.Equal(now), ShouldBeTrue)
+			tm, ok = params.GetTime(`timeStr`)
+			So(ok, ShouldBeTrue)
+			So(tm.Equal(now), ShouldBeTrue)
+			_, ok = params.GetTime(`str`)
+			So(ok, ShouldBeFalse)
+
+			Convey("after json round trip", func() {
+				restored := NewExtraData()
+				So(restored.FromJSON(params.ToJSON()), ShouldBeNil)
+
+				i, ok := restored.GetInt(`number`)
+				So(ok, ShouldBeTrue)
+				So(i, ShouldEqual, int64(9007199254740993))
+				So(restored.Get(`int`), ShouldEqual, json.Number(`12`))
+
+				d, _ := restored.GetDuration(`duration`)
+				So(d, ShouldEqual, time.Second)
+
+				tm, ok := restored.GetTime(`time`)
+				So(ok, ShouldBeTrue)
+				So(tm.Equal(now), ShouldBeTrue)
+			})
+		})
+
+		Convey("Merge", func() {
+			params.Set(`http.method`, `GET`).Set(`service`, `api`)
+			other := ExtraData{`http`: map[string]interface{}{`status`: 200}, `service`: `web`}
+
+			params.Merge(other)
+
+			So(params.Get(`http.method`), ShouldEqual, `GET`)
+			So(params.Get(`http.status`), ShouldEqual, 200)
+			So(params.Get(`service`), ShouldEqual, `web`)
+
+			other[`http`].(map[string]interface{})[`status`] = 500
+			So(params.Get(`http.status`), ShouldEqual, 200)
+
+			var empty ExtraData
+			params.Merge(empty)
+			So(params.Len(), ShouldEqual, 2)
+		})
+
+		Convey("Registered encoder", func() {
+			type user struct {
+				Name     string
+				Password string
+			}
+			RegisterDataEncoder(user{}, func(val interface{}) interface{} {
+				return fmt.Sprintf(`user %s`, val.(user).Name)
+			})
+
+			params.
+				Set(`user`, user{`bob`, `secret`}).
+				Set(`ptr`, &user{`alice`, `secret`}).
+				Set(`list`, []interface{}{user{`eve`, `secret`}})
+
+			So(string(params.ToJSON()), ShouldEqual, `{"list":["user eve"],"ptr":"user alice","user":"user bob"}`)
+			So(params.Get(`user`), ShouldResemble, user{`bob`, `secret`})
+		})
+	})
+}
+
+func TestCopyValue(t *testing.T) {
+
+	Convey("Copy data tree", t, func() {
+		nested := map[string]interface{}{`key`: `val`}
+		list := []interface{}{nested, 1}
+		data := ExtraData{`nested`: nested, `list`: list, `str`: `val`}
+
+		res := copyValue(data).(ExtraData)
+		So(res, ShouldResemble, data)
+
+		nested[`key`] = `changed`
+		list[1] = 2
+
+		So(res[`nested`].(map[string]interface{})[`key`], ShouldEqual, `val`)
+		So(res[`list`].([]interface{})[1], ShouldEqual, 1)
+		So(res[`list`].([]interface{})[0].(map[string]interface{})[`key`], ShouldEqual, `val`)
+	})
+
+	Convey("Copy typed maps and slices", t, func() {
+		header := http.Header{`Accept`: {`text/plain`}}
+		labels := map[string]string{`team`: `core`}
+		tags := []string{`a`, `b`}
+		nested := map[string][]map[string]int{`list`: {{`n`: 1}}}
+		data := ExtraData{`header`: header, `labels`: labels, `tags`: tags, `nested`: nested, `nil`: map[string]string(nil)}
+
+		res := copyValue(data).(ExtraData)
+		So(res, ShouldResemble, data)
+
+		header.Add(`Accept`, `text/html`)
+		header[`Accept`][0] = `changed`
+		labels[`team`] = `changed`
+		tags[0] = `changed`
+		nested[`list`][0][`n`] = 2
+
+		So(res[`header`], ShouldResemble, http.Header{`Accept`: {`text/plain`}})
+		So(res[`labels`], ShouldResemble, map[string]string{`team`: `core`})
+		So(res[`tags`], ShouldResemble, []string{`a`, `b`})
+		So(res[`nested`], ShouldResemble, map[string][]map[string]int{`list`: {{`n`: 1}}})
+		So(res[`nil`], ShouldBeNil)
+
+		log := NewLog(`typed`)
+		log.SetData(`labels`, labels)
+		log.GetData(`labels`).(map[string]string)[`team`] = `other`
+		So(log.GetData(`labels`), ShouldResemble, map[string]string{`team`: `changed`})
+	})
+
+	Convey("Clear replaces the map", t, func() {
+		data := ExtraData{`key`: `val`}
+		old := data
+
+		data.Clear()
+		So(data.Len(), ShouldEqual, 0)
+		So(old.Get(`key`), ShouldEqual, `val`)
 	})
 }
@@ -0,0 +1,94 @@
+// Package tracetest has fake driver for tests of contrib packages
+package tracetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/efureev/tracefall"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Driver records sent logs. Its methods are safe for concurrent use
+type Driver struct {
+	mu   sync.Mutex
+	logs []*tracefall.Log
+}
+
+// Send record the log
+func (d *Driver) Send(l *tracefall.Log) (tracefall.ResponseCmd, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.logs = append(d.logs, l)
+	return *tracefall.NewResponse(l).Success().ToCmd(), nil
+}
+
+// Sent return recorded logs
+func (d *Driver) Sent() []*tracefall.Log {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]*tracefall.Log{}, d.logs...)
+}
+
+// ByName return recorded logs with the name
+func (d *Driver) ByName(name string) []*tracefall.Log {
+	var list []*tracefall.Log
+	for _, l := range d.Sent() {
+		if l.Name == name {
+			list = append(list, l)
+		}
+	}
+	return list
+}
+
+// Reset remove recorded logs
+func (d *Driver) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.logs = nil
+}
+
+func (d *Driver) RemoveThread(id uuid.UUID) (tracefall.ResponseCmd, error) {
+	return *tracefall.NewResponse(id).Success().ToCmd(), nil
+}
+
+func (d *Driver) RemoveByTags(tags tracefall.Tags) (tracefall.ResponseCmd, error) {
+	return *tracefall.NewResponse(tags).Success().ToCmd(), nil
+}
+
+func (d *Driver) GetLog(id uuid.UUID) (tracefall.ResponseLog, error) {
+	return *tracefall.NewResponse(id).SetError(errors.New(`not supported`)).ToLog(nil), nil
+}
+
+func (d *Driver) GetThread(id uuid.UUID) (tracefall.ResponseThread, error) {
+	return *tracefall.NewResponse(id).Success().ToThread(tracefall.Thread{}), nil
+}
+
+func (d *Driver) Truncate(ind string) (tracefall.ResponseCmd, error) {
+	return *tracefall.NewResponse(ind).Success().ToCmd(), nil
+}
+
+func (d *Driver) Open(map[string]string) (interface{}, error) {
+	return nil, nil
+}
+
+type connector struct {
+	driver *Driver
+}
+
+func (c connector) Connect(_ context.Context) (interface{}, error) {
+	return c.driver.Open(nil)
+}
+
+func (c connector) Driver() tracefall.Driver {
+	return c.driver
+}
+
+// OpenDB open DB which sends logs to the driver. The driver is not registered
+func OpenDB(d *Driver) (*tracefall.DB, error) {
+	return tracefall.OpenDB(connector{driver: d})
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -35,79 +37,161 @@ type LogJSON struct {
 	App         string        `json:"app"`
 	Time        int64         `json:"time"`
 	TimeEnd     *int64        `json:"timeEnd"`
+	Duration    *int64        `json:"duration,omitempty"`
 	Result      bool          `json:"result"`
+	Status      Status        `json:"status"`
 	Finish      bool          `json:"finish"`
 	Environment string        `json:"env"`
-	Error       *string       `json:"error"`
+	Error       *ErrorInfo    `json:"error"`
 	Data        ExtraData     `json:"data"`
 	Notes       NoteGroupList `json:"notes"`
 	Tags        []string      `json:"tags"`
 	Parent      *string       `json:"parent"`
+	Resource    *Resource     `json:"resource,omitempty"`
 	//Step        uint16       `json:"step"`
 }
 
-// Log struct
+// Log struct. Its methods are safe for concurrent use. Data, notes and tags are changed only by methods of the log
+// (SetData, AddNote, AddTag, ...), their getters return copies
 type Log struct {
 	ID          uuid.UUID
 	Thread      uuid.UUID
 	Name        string
-	Data        ExtraData
+	data        ExtraData
 	App         string
-	Notes       NoteGroups
-	Tags        Tags
+	notes       NoteGroups
+	tags        Tags
 	Error       error
+	ErrorInfo   *ErrorInfo
 	Environment string
 	//Step        uint16
 
 	Result bool
+	Status Status
 	Finish bool
 
 	Time    time.Time
 	TimeEnd *time.Time
 	Parent  *Log
 	//items   []*Log
+
+	Sampling SamplingDecision
+	Resource *Resource
+
+	// elapsed is duration of restored log, which times have no monotonic clock reading
+	elapsed *time.Duration
+
+	// root is true for log of NewLog: its head sampling decision is made once, see sampling
+	root       bool
+	sampleOnce sync.Once
+
+	mu sync.RWMutex
 }
 
 // SetName set log name
 func (l *Log) SetName(name string) *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.Name = name
 	return l
 }
 
-// FinishTimeEnd set finish time of the log
+// FinishTimeEnd set finish time of the log. The log which is not finished yet gets status by its result:
+// success or failed
 func (l *Log) FinishTimeEnd() *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.finishTimeEnd()
+	l.Status = l.getStatus()
+	return l
+}
+
+func (l *Log) finishTimeEnd() {
 	n := time.Now()
 	l.TimeEnd = &n
-	return l
+	l.elapsed = nil
+}
+
+// Duration return duration of the log. It is measured by the monotonic clock, so it is not affected by
+// clock adjustments. Duration of the log which is not finished yet is time passed since its start
+func (l *Log) Duration() time.Duration {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.duration()
+}
+
+func (l *Log) duration() time.Duration {
+	if l.TimeEnd == nil {
+		return time.Since(l.Time)
+	}
+	if l.elapsed != nil {
+		return *l.elapsed
+	}
+	return l.TimeEnd.Sub(l.Time)
 }
 
 // ThreadFinish finish thread line
 func (l *Log) ThreadFinish() *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.Finish = true
 	return l
 }
 
 // Success set result of the log: success
 func (l *Log) Success() *Log {
-	l.FinishTimeEnd().Result = true
+	l.mu.Lock()
+	l.finishTimeEnd()
+	l.Result = true
+	l.Status = StatusSuccess
+	l.mu.Unlock()
+
+	getProcessors().onFinish(l)
 	return l
 }
 
-// Fail set result of the log: error
+// Fail set result of the log: error. Type and chain of the error are kept in ErrorInfo,
+// stack trace is captured if it is turned on by SetErrorStack.
+// Status is failed, or timeout and cancelled for errors of context: context.DeadlineExceeded and context.Canceled
 func (l *Log) Fail(err error) *Log {
+	info := NewErrorInfo(err)
+	if info != nil && atomic.LoadInt32(&errorStack) == 1 {
+		info.CaptureStack(1)
+	}
+	return l.fail(err, info)
+}
+
+func (l *Log) fail(err error, info *ErrorInfo) *Log {
+	l.mu.Lock()
 	l.Result = false
+	l.Status = statusOfError(err)
 	l.Error = err
-	return l.FinishTimeEnd()
+	l.ErrorInfo = info
+	l.finishTimeEnd()
+	l.mu.Unlock()
+
+	getProcessors().onFinish(l)
+	return l
 }
 
 // SetEnvironment set environment name of log
 func (l *Log) SetEnvironment(env string) *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.Environment = env
 	return l
 }
 
 // SetApplication set application name of log
 func (l *Log) SetApplication(str string) *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.App = str
 	return l
 }
@@ -120,44 +204,75 @@ var ErrorParentThreadDiff = errors.New(`the Parent Thread is different from the
 
 // SetParent set parent to log for for create Thread
 func (l *Log) SetParent(parent *Log) error {
-	if parent.Finish {
+	if parent == nil {
+		return nil
+	}
+
+	parent.mu.RLock()
+	finish, thread := parent.Finish, parent.Thread
+	parent.mu.RUnlock()
+
+	if finish {
 		return ErrorParentFinish
 	}
 
-	if parent.Thread.String() != l.Thread.String() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if thread != l.Thread {
 		return ErrorParentThreadDiff
 	}
 
-	if parent != nil {
-		l.Parent = parent
-		//parent.items = append(parent.items, l)
-	}
+	l.Parent = parent
+	//parent.items = append(parent.items, l)
 
 	return nil
 }
 
 // SetParentID set parent ID to log
 func (l *Log) SetParentID(id uuid.UUID) *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.Parent = &Log{ID: id, Thread: l.Thread}
 	return l
 }
 
 // CreateChild make new log and attach it to current log as child
 func (l *Log) CreateChild(name string) (*Log, error) {
+	child, err := l.createChild(name)
+	if err != nil {
+		return nil, err
+	}
+
+	list := getProcessors()
+	list.onCreate(child)
+	list.onChildCreated(l, child)
+
+	return child, nil
+}
+
+func (l *Log) createChild(name string) (*Log, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	if l.Finish {
 		return nil, ErrorParentFinish
 	}
-	child := NewLog(name)
+	child := newLog(name)
 	child.Thread = l.Thread
 	child.App = l.App
 	child.Environment = l.Environment
 	child.Parent = l
+	child.Sampling = l.Sampling
+	child.Resource = l.Resource
 
 	return child, nil
 }
 
-// ToJSON create json bytes from Log data
-func (l Log) ToJSON() []byte {
+// ToJSON create json bytes from Log data. Fields are read under the lock of the log, so ToJSON, ToLogJSON
+// and String have pointer receivers: use *Log for them, Log value does not implement fmt.Stringer
+func (l *Log) ToJSON() []byte {
 	b, _ := l.MarshalJSON()
 	return b
 }
@@ -167,11 +282,14 @@ func (l *Log) MarshalJSON() ([]byte, error) {
 	return json.Marshal(l.ToLogJSON())
 }
 
-// ToLogJSON return JsonLog Struct
-func (l Log) ToLogJSON() *LogJSON {
+// ToLogJSON return JsonLog Struct. Data, Notes and Tags are copied
+func (l *Log) ToLogJSON() *LogJSON {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	var (
-		parentID, er *string
-		te           *int64
+		parentID *string
+		te, dur  *int64
 	)
 	if l.Parent != nil {
 		pid := l.Parent.ID.String()
@@ -183,11 +301,8 @@ func (l Log) ToLogJSON() *LogJSON {
 	if l.TimeEnd != nil {
 		teInt := l.TimeEnd.UnixNano()
 		te = &teInt
-	}
-
-	if l.Error != nil {
-		e1 := l.Error.Error()
-		er = &e1
+		durInt := int64(l.duration())
+		dur = &durInt
 	}
 
 	return &LogJSON{
@@ -197,62 +312,442 @@ func (l Log) ToLogJSON() *LogJSON {
 		App:         l.App,
 		Time:        l.Time.UnixNano(),
 		TimeEnd:     te,
+		Duration:    dur,
 		Result:      l.Result,
+		Status:      l.getStatus(),
 		Finish:      l.Finish,
 		Environment: l.Environment,
-		Error:       er,
-		Data:        l.Data,
-		Notes:       l.Notes.prepareToJSON(),
-		Tags:        l.Tags,
+		Error:       l.getErrorInfo(),
+		Data:        l.data.Copy(),
+		Notes:       l.notes.prepareToJSON(),
+		Tags:        l.tags.List(),
 		Parent:      parentID,
+		Resource:    l.Resource,
 		//Step : l.Step,
 	}
 }
 
+// GetErrorInfo return copy of ErrorInfo of the log. It is made from Error if the error is set directly, not by Fail
+func (l *Log) GetErrorInfo() *ErrorInfo {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.getErrorInfo()
+}
+
+func (l *Log) getErrorInfo() *ErrorInfo {
+	if l.ErrorInfo != nil && l.Error != nil && l.ErrorInfo.Message == l.Error.Error() {
+		return l.ErrorInfo.Copy()
+	}
+	return NewErrorInfo(l.Error)
+}
+
+// UnmarshalJSON restore log from json
+func (l *Log) UnmarshalJSON(b []byte) error {
+	var lj LogJSON
+	if err := json.Unmarshal(b, &lj); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return lj.fill(l)
+}
+
+// ToLog restore Log from LogJSON struct
+func (lj *LogJSON) ToLog() (*Log, error) {
+	l := &Log{}
+	if err := lj.fill(l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (lj *LogJSON) fill(l *Log) error {
+	var (
+		parent  *Log
+		timeEnd *time.Time
+		elapsed *time.Duration
+		err     error
+		info    *ErrorInfo
+	)
+
+	if lj.Parent != nil {
+		pid, e := uuid.FromString(*lj.Parent)
+		if e != nil {
+			return e
+		}
+		parent = &Log{ID: pid, Thread: lj.Thread}
+	}
+
+	if lj.TimeEnd != nil {
+		te := time.Unix(0, *lj.TimeEnd)
+		timeEnd = &te
+		if lj.Duration != nil {
+			d := time.Duration(*lj.Duration)
+			elapsed = &d
+		}
+	}
+
+	if lj.Error != nil {
+		info = lj.Error.Copy()
+		err = info
+	}
+
+	data := lj.Data.Copy()
+	if data == nil {
+		data = NewExtraData()
+	}
+
+	notes := NewNotesGroups()
+	for _, ng := range lj.Notes {
+		if ng != nil {
+			notes.AddNoteGroup(ng.Copy())
+		}
+	}
+
+	l.ID = lj.ID
+	l.Thread = lj.Thread
+	l.Name = lj.Name
+	l.App = lj.App
+	l.Environment = lj.Environment
+	l.Time = time.Unix(0, lj.Time)
+	l.TimeEnd = timeEnd
+	l.elapsed = elapsed
+	l.Result = lj.Result
+	l.Status = lj.Status
+	if l.Status == `` {
+		l.Status = StatusFromResult(lj.Result, lj.TimeEnd != nil)
+	}
+	l.Finish = lj.Finish
+	l.Error = err
+	l.ErrorInfo = info
+	l.data = data
+	l.notes = notes
+	l.tags = append(Tags{}, lj.Tags...)
+	l.Parent = parent
+	l.Resource = lj.Resource
+
+	return nil
+}
+
 // String return string representation of log
-func (l Log) String() string {
+func (l *Log) String() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	return fmt.Sprintf("[%s] %s", l.Time, l.Name)
 }
 
-// SetDefaults set values for Log by default
+// SetDefaults set values for Log by default. Application and environment are taken from Resource if it has them.
+// Status is pending, or failed if the log has finish time
 func (l *Log) SetDefaults() *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.App = `App`
 	l.Environment = EnvironmentDev
+	if l.Resource != nil {
+		if l.Resource.App != `` {
+			l.App = l.Resource.App
+		}
+		if l.Resource.Environment != `` {
+			l.Environment = l.Resource.Environment
+		}
+	}
 	l.Result = false
+	l.Status = StatusFromResult(false, l.TimeEnd != nil)
+	return l
+}
+
+// SetResource set resource of log
+func (l *Log) SetResource(r *Resource) *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.Resource = r
+	return l
+}
+
+// SetData set value of Data by key. The key may be a path into nested maps (see ExtraData.Set)
+func (l *Log) SetData(key string, val interface{}) *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.data == nil {
+		l.data = NewExtraData()
+	}
+	l.data.Set(key, val)
 	return l
 }
 
-// NewLog create new Log
+// Data return deep copy of data of the log
+func (l *Log) Data() ExtraData {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.data.Copy()
+}
+
+// MergeData merge other data into data of the log (see ExtraData.Merge)
+func (l *Log) MergeData(other ExtraData) *Log {
+	other = other.Copy()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.data == nil {
+		l.data = NewExtraData()
+	}
+	l.data.Merge(other)
+	return l
+}
+
+// GetData return value of Data by key. The key may be a path into nested maps (see ExtraData.Get).
+// Maps and slices of the value are copied, so they are not changed by further SetData
+func (l *Log) GetData(key string) interface{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return copyValue(l.data.Get(key))
+}
+
+// AddNote add Note struct to exist group (or create new if absent) in Notes
+func (l *Log) AddNote(group string, note *Note) *Log {
+	if note == nil {
+		return l
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.notes == nil {
+		l.notes = NewNotesGroups()
+	}
+	l.notes.AddNote(group, note)
+	return l
+}
+
+// NoteDebug add note with debug level to group
+func (l *Log) NoteDebug(group, note string, attrs ...Attr) *Log {
+	return l.addLevelNote(group, LevelDebug, note, nil, attrs)
+}
+
+// NoteInfo add note with info level to group
+func (l *Log) NoteInfo(group, note string, attrs ...Attr) *Log {
+	return l.addLevelNote(group, LevelInfo, note, nil, attrs)
+}
+
+// NoteWarn add note with warn level to group
+func (l *Log) NoteWarn(group, note string, attrs ...Attr) *Log {
+	return l.addLevelNote(group, LevelWarn, note, nil, attrs)
+}
+
+// NoteError add note with error level and attached error to group
+func (l *Log) NoteError(group, note string, err error, attrs ...Attr) *Log {
+	return l.addLevelNote(group, LevelError, note, err, attrs)
+}
+
+func (l *Log) addLevelNote(group string, level NoteLevel, msg string, err error, attrs []Attr) *Log {
+	return l.AddNote(group, levelNote(level, msg, err, attrs, 2))
+}
+
+// AddNotes add notes to exist group (or create new if absent)
+func (l *Log) AddNotes(group string, notes ...string) *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.notes == nil {
+		l.notes = NewNotesGroups()
+	}
+	l.notes.AddGroup(group, notes)
+	return l
+}
+
+// AddNoteGroup add copy of the group to notes of the log. Group with the same label is replaced
+func (l *Log) AddNoteGroup(group *NoteGroup) *Log {
+	if group == nil {
+		return l
+	}
+	group = group.Copy()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.notes == nil {
+		l.notes = NewNotesGroups()
+	}
+	l.notes.AddNoteGroup(group)
+	return l
+}
+
+// Notes return copies of note groups of the log in order of NoteGroups.List
+func (l *Log) Notes() NoteGroupList {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.notes.List()
+}
+
+// NoteGroup return copy of the group of notes by label, nil if it is absent
+func (l *Log) NoteGroup(label string) *NoteGroup {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if g := l.notes.Get(label); g != nil {
+		return g.Copy()
+	}
+	return nil
+}
+
+// AddTag add tag to Tags
+func (l *Log) AddTag(tag string) *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tags.Add(tag)
+	return l
+}
+
+// Tags return copy of tags of the log
+func (l *Log) Tags() Tags {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return Tags(l.tags.List())
+}
+
+// NewLog create new root Log, then global processors are called. Head sampling decision of the log is made
+// by the global Sampler (see SetSampler) on its first Send or ToShadow, when the log has its application
+// and is not continuation of remote thread (see ParentFromShadow)
 func NewLog(name string) *Log {
+	l := newLog(name)
+	l.root = true
+	getProcessors().onCreate(l)
+	return l
+}
+
+// Sampled return true if the log has to be stored
+func (l *Log) Sampled() bool {
+	return l.sampling().Sampled()
+}
+
+// sampling return head sampling decision of the log. Undecided log takes decision of its parent, the root log
+// of NewLog is decided by the global Sampler once. Continuations of remote threads without decision stay undecided
+func (l *Log) sampling() SamplingDecision {
+	l.mu.RLock()
+	decision, parent, root := l.Sampling, l.Parent, l.root
+	l.mu.RUnlock()
+
+	switch {
+	case decision != SamplingUndecided:
+		return decision
+	case parent != nil:
+		decision = parent.sampling()
+	case root:
+		l.sampleOnce.Do(func() {
+			decision = headSample(l.Snapshot())
+		})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.Sampling == SamplingUndecided {
+		l.Sampling = decision
+	}
+	return l.Sampling
+}
+
+func newLog(name string) *Log {
 	id := generateUUID()
 	return (&Log{
-		ID:     id,
-		Thread: id,
-		Name:   name,
-		Data:   NewExtraData(),
-		Notes:  NewNotesGroups(),
-		Result: false,
-		Tags:   Tags{},
-		Time:   time.Now(),
+		ID:       id,
+		Thread:   id,
+		Name:     name,
+		data:     NewExtraData(),
+		notes:    NewNotesGroups(),
+		Result:   false,
+		tags:     Tags{},
+		Time:     time.Now(),
+		Resource: GetResource(),
 	}).SetDefaults()
 }
 
+// Snapshot return deep copy of the log: Data, Notes and Tags are copied, Parent is detached to its shadow.
+// Snapshot is not affected by further mutations of the log
+func (l *Log) Snapshot() *Log {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	s := &Log{
+		ID:          l.ID,
+		Thread:      l.Thread,
+		Name:        l.Name,
+		data:        l.data.Copy(),
+		App:         l.App,
+		notes:       l.notes.Copy(),
+		tags:        Tags(l.tags.List()),
+		Error:       l.Error,
+		ErrorInfo:   l.ErrorInfo.Copy(),
+		Environment: l.Environment,
+		Result:      l.Result,
+		Status:      l.Status,
+		Finish:      l.Finish,
+		Time:        l.Time,
+		Sampling:    l.Sampling,
+		Resource:    l.Resource,
+	}
+
+	if l.TimeEnd != nil {
+		te := *l.TimeEnd
+		s.TimeEnd = &te
+	}
+	if l.elapsed != nil {
+		d := *l.elapsed
+		s.elapsed = &d
+	}
+
+	if l.Parent != nil {
+		shadow := l.Parent.ToShadow()
+		s.Parent = &Log{ID: shadow.ID, Thread: shadow.Thread}
+	}
+
+	return s
+}
+
 // LogParentShadow struct
 type LogParentShadow struct {
-	ID     uuid.UUID `json:"id"`
-	Thread uuid.UUID `json:"thread"`
+	ID       uuid.UUID        `json:"id"`
+	Thread   uuid.UUID        `json:"thread"`
+	Sampling SamplingDecision `json:"sampling,omitempty"`
 }
 
-// ToShadow create new shadow struct of log
-func (l Log) ToShadow() *LogParentShadow {
-	return &LogParentShadow{l.ID, l.Thread}
+// ToShadow create new shadow struct of log. Head sampling decision of the thread is made for the shadow
+func (l *Log) ToShadow() *LogParentShadow {
+	decision := l.sampling()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return &LogParentShadow{l.ID, l.Thread, decision}
 }
 
-// ParentFromShadow return Parent's ID from LogShadow
+// ParentFromShadow return Parent's ID from LogShadow. Sampling decision of the shadow is taken if it is made.
+// Shadow without thread (sampling decision only, see B3) does not set the parent
 func (l *Log) ParentFromShadow(shadow *LogParentShadow) *Log {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	if shadow != nil {
-		l.Parent = &Log{ID: shadow.ID, Thread: shadow.Thread}
-		l.Thread = shadow.Thread
+		if !uuid.Equal(shadow.Thread, uuid.Nil) {
+			l.Parent = &Log{ID: shadow.ID, Thread: shadow.Thread}
+			l.Thread = shadow.Thread
+		}
+		if shadow.Sampling != SamplingUndecided {
+			l.Sampling = shadow.Sampling
+		}
 	}
 	return l
 }
@@ -264,11 +759,15 @@ func (l *Log) GetLevel() int {
 	current := l
 	level := rootLevel
 	for {
-		if current.Parent == nil {
+		current.mu.RLock()
+		parent := current.Parent
+		current.mu.RUnlock()
+
+		if parent == nil {
 			break
 		}
 		level++
-		current = current.Parent
+		current = parent
 	}
 
 	return level
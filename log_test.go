@@ -1,10 +1,14 @@
 package tracefall
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
 	"reflect"
+	"sync"
 	"testing"
+	"testing/quick"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
@@ -40,8 +44,8 @@ func TestLog(t *testing.T) {
 			So(log.Environment, ShouldEqual, EnvironmentDev)
 			So(log.Result, ShouldBeFalse)
 
-			So(log.Data, ShouldHaveSameTypeAs, ExtraData{})
-			So(log.Notes, ShouldHaveSameTypeAs, NoteGroups{})
+			So(log.Data(), ShouldHaveSameTypeAs, ExtraData{})
+			So(log.Notes(), ShouldHaveSameTypeAs, NoteGroupList{})
 
 			spew.Dump(string(log.ToJSON()))
 		})
@@ -53,27 +57,30 @@ func TestLog(t *testing.T) {
 		})
 
 		Convey("Add Tags", func() {
-			log.Tags.Add(`first`)
-			log.Tags.Add(`second`)
+			log.AddTag(`first`)
+			log.AddTag(`second`)
 
-			So(log.Tags.List(), ShouldResemble, []string{`first`, `second`})
-			So(log.Tags, ShouldResemble, Tags{`first`, `second`})
+			So(log.Tags().List(), ShouldResemble, []string{`first`, `second`})
+			So(log.Tags(), ShouldResemble, Tags{`first`, `second`})
 		})
 
 		Convey("Add Note", func() {
-			log.Notes.Add(`first group`, `first note`)
-			log.Notes.Add(`second group`, `first note`)
-			log.Notes.Add(`first group`, `second note`)
-			log.Notes.Add(`first group`, `third note`)
-
-			So(log.Notes.Count(), ShouldEqual, 2)
-			So(log.Notes.Get(`first group`).Count(), ShouldEqual, 3)
-
-			log.Notes.Get(`second group`).Clear()
-			So(log.Notes.Get(`second group`).Count(), ShouldEqual, 0)
-
-			log.Notes.Get(`first group`).Add(`adding`)
-			So(log.Notes.Get(`first group`).Count(), ShouldEqual, 4)
+			log.AddNotes(`first group`, `first note`)
+			log.AddNotes(`second group`, `first note`)
+			log.AddNotes(`first group`, `second note`)
+			log.AddNotes(`first group`, `third note`)
+
+			So(len(log.Notes()), ShouldEqual, 2)
+			So(log.Notes().Get(`first group`).Count(), ShouldEqual, 3)
+
+			// groups are copies
+			log.Notes().Get(`second group`).Clear()
+			So(log.Notes().Get(`second group`).Count(), ShouldEqual, 1)
+			So(log.NoteGroup(`second group`).Count(), ShouldEqual, 1)
+			So(log.NoteGroup(`absent`), ShouldBeNil)
+
+			log.AddNotes(`first group`, `adding`)
+			So(log.Notes().Get(`first group`).Count(), ShouldEqual, 4)
 		})
 
 		Convey("Time", func() {
@@ -248,8 +255,8 @@ func TestLog(t *testing.T) {
 			So(child.App, ShouldEqual, log.App)
 			So(child.Environment, ShouldEqual, log.Environment)
 
-			So(child.Data, ShouldHaveSameTypeAs, ExtraData{})
-			So(child.Notes, ShouldHaveSameTypeAs, NoteGroups{})
+			So(child.Data(), ShouldHaveSameTypeAs, ExtraData{})
+			So(child.notes, ShouldHaveSameTypeAs, NoteGroups{})
 
 			So(child.String(), ShouldEqual, fmt.Sprintf("[%s] %s", child.Time, child.Name))
 		})
@@ -264,9 +271,9 @@ func TestLog(t *testing.T) {
 		})
 
 		Convey("To LogJson Struct", func() {
-			log.Tags.Add(`tag 1`)
-			log.Notes.Add(`group`, `note 1`)
-			log.Data.Set(`key`, `val`)
+			log.AddTag(`tag 1`)
+			log.AddNotes(`group`, `note 1`)
+			log.SetData(`key`, `val`)
 			lJSON := log.ToLogJSON()
 
 			So(lJSON, ShouldHaveSameTypeAs, &LogJSON{})
@@ -278,36 +285,39 @@ func TestLog(t *testing.T) {
 			So(lJSON.App, ShouldEqual, log.App)
 			So(lJSON.Environment, ShouldEqual, log.Environment)
 			So(lJSON.Tags, ShouldHaveSameTypeAs, []string{})
-			So(lJSON.Tags, ShouldResemble, log.Tags.List())
+			So(lJSON.Tags, ShouldResemble, log.Tags().List())
 			So(lJSON.Parent, ShouldBeNil)
 			So(lJSON.TimeEnd, ShouldBeNil)
 			So(lJSON.Finish, ShouldEqual, log.Finish)
 			So(lJSON.Error, ShouldEqual, log.Error)
 			So(lJSON.Result, ShouldEqual, log.Result)
 			//So(lJSON.Step, ShouldEqual, log.Step)
-			So(lJSON.Data, ShouldResemble, log.Data)
-			So(lJSON.Notes, ShouldResemble, log.Notes.prepareToJSON())
+			So(lJSON.Data, ShouldResemble, log.Data())
+			So(lJSON.Notes, ShouldResemble, log.Notes())
 		})
 
 		Convey("To Json", func() {
-			log.Tags.Add(`tag 1`)
-			log.Notes.Add(`group first`, `note 1`)
-			log.Data.Set(`key`, `val`)
+			log.AddTag(`tag 1`)
+			log.AddNotes(`group first`, `note 1`)
+			log.SetData(`key`, `val`)
+
+			resource, _ := json.Marshal(log.Resource)
 
 			Convey("Simple log", func() {
 				jsonBytes := log.ToJSON()
 
-				expected := fmt.Sprintf(`{"id":"%s","thread":"%s","name":"test log","app":"%s","time":%d,"timeEnd":null,"result":false,"finish":false,"env":"%s","error":null,"data":{"key":"%s"},"notes":[{"notes":[{"t":%d,"v":"%s"}],"label":"%s"}],"tags":["%s"],"parent":null}`,
+				expected := fmt.Sprintf(`{"id":"%s","thread":"%s","name":"test log","app":"%s","time":%d,"timeEnd":null,"result":false,"status":"pending","finish":false,"env":"%s","error":null,"data":{"key":"%s"},"notes":[{"notes":[{"t":%d,"v":"%s"}],"label":"%s"}],"tags":["%s"],"parent":null,"resource":%s}`,
 					log.ID,
 					log.Thread,
 					log.App,
 					log.Time.UnixNano(),
 					log.Environment,
-					log.Data.Get(`key`),
-					log.Notes.Get(`group first`).Notes[0].Time,
-					log.Notes.Get(`group first`).Notes[0].Note,
-					log.Notes.Get(`group first`).Label,
-					log.Tags[0],
+					log.Data().Get(`key`),
+					log.Notes().Get(`group first`).Notes[0].Time,
+					log.Notes().Get(`group first`).Notes[0].Note,
+					log.Notes().Get(`group first`).Label,
+					log.Tags()[0],
+					resource,
 					//log.Step,
 				)
 
@@ -318,19 +328,21 @@ func TestLog(t *testing.T) {
 				log.Fail(errors.New(`fail`)).ThreadFinish()
 				jsonBytes := log.ToJSON()
 
-				expected := fmt.Sprintf(`{"id":"%s","thread":"%s","name":"test log","app":"%s","time":%d,"timeEnd":%d,"result":false,"finish":true,"env":"%s","error":"%s","data":{"key":"%s"},"notes":[{"notes":[{"t":%d,"v":"%s"}],"label":"%s"}],"tags":["%s"],"parent":null}`,
+				expected := fmt.Sprintf(`{"id":"%s","thread":"%s","name":"test log","app":"%s","time":%d,"timeEnd":%d,"duration":%d,"result":false,"status":"failed","finish":true,"env":"%s","error":{"message":"%s","type":"*errors.errorString"},"data":{"key":"%s"},"notes":[{"notes":[{"t":%d,"v":"%s"}],"label":"%s"}],"tags":["%s"],"parent":null,"resource":%s}`,
 					log.ID,
 					log.Thread,
 					log.App,
 					log.Time.UnixNano(),
 					log.TimeEnd.UnixNano(),
+					log.Duration().Nanoseconds(),
 					log.Environment,
 					log.Error.Error(),
-					log.Data.Get(`key`),
-					log.Notes.Get(`group first`).Notes[0].Time,
-					log.Notes.Get(`group first`).Notes[0].Note,
-					log.Notes.Get(`group first`).Label,
-					log.Tags[0],
+					log.Data().Get(`key`),
+					log.Notes().Get(`group first`).Notes[0].Time,
+					log.Notes().Get(`group first`).Notes[0].Note,
+					log.Notes().Get(`group first`).Label,
+					log.Tags()[0],
+					resource,
 					//log.Step,
 				)
 
@@ -340,9 +352,9 @@ func TestLog(t *testing.T) {
 
 		Convey("Trees", func() {
 			root := NewLog(`test log`)
-			root.Tags.Add(`tag 1`)
-			root.Notes.Add(`group first`, `note 1`)
-			root.Data.Set(`key`, `val`)
+			root.AddTag(`tag 1`)
+			root.AddNotes(`group first`, `note 1`)
+			root.SetData(`key`, `val`)
 
 			parent := root
 
@@ -402,3 +414,403 @@ func TestLog(t *testing.T) {
 
 	})
 }
+
+func TestLogSnapshot(t *testing.T) {
+
+	Convey("Log Snapshot", t, func() {
+		parent := NewLog(`parent`)
+		log, _ := parent.CreateChild(`test log`)
+		log.AddTag(`tag 1`)
+		log.AddNotes(`group`, `note 1`)
+		log.SetData(`key`, `val`).SetData(`nested`, map[string]interface{}{`key`: `val`})
+		log.Fail(errors.New(`fail`))
+
+		snap := log.Snapshot()
+
+		Convey("Equal to origin", func() {
+			So(snap, ShouldNotEqual, log)
+			So(snap.ToJSON(), ShouldResemble, log.ToJSON())
+			So(snap.String(), ShouldEqual, log.String())
+			So(snap.GetLevel(), ShouldEqual, 1)
+		})
+
+		Convey("Parent is detached", func() {
+			So(snap.Parent, ShouldNotEqual, parent)
+			So(snap.Parent.ID, ShouldEqual, parent.ID)
+			So(snap.Parent.Thread, ShouldEqual, parent.Thread)
+			So(snap.Parent.Parent, ShouldBeNil)
+			So(snap.Parent.data, ShouldBeNil)
+		})
+
+		Convey("Independent of origin", func() {
+			log.AddTag(`tag 2`)
+			log.AddNotes(`group`, `note 2`).AddNotes(`group 2`, `note`)
+			log.SetData(`key`, `val 2`)
+			log.data.Get(`nested`).(map[string]interface{})[`key`] = `val 2`
+			log.SetName(`renamed`).Success()
+			*log.TimeEnd = log.TimeEnd.Add(time.Hour)
+
+			So(snap.Tags().List(), ShouldResemble, []string{`tag 1`})
+			So(snap.Notes(), ShouldHaveLength, 1)
+			So(snap.Notes().Get(`group`).Count(), ShouldEqual, 1)
+			So(snap.Data().Get(`key`), ShouldEqual, `val`)
+			So(snap.Data().Get(`nested`).(map[string]interface{})[`key`], ShouldEqual, `val`)
+			So(snap.Name, ShouldEqual, `test log`)
+			So(snap.Result, ShouldBeFalse)
+			So(snap.Error.Error(), ShouldEqual, `fail`)
+			So(*snap.TimeEnd, ShouldHappenBefore, *log.TimeEnd)
+		})
+
+		Convey("Root log", func() {
+			root := NewLog(`root`).Snapshot()
+			So(root.Parent, ShouldBeNil)
+			So(root.TimeEnd, ShouldBeNil)
+		})
+	})
+}
+
+func newBenchmarkLog() *Log {
+	parent := NewLog(`parent`)
+	log, _ := parent.CreateChild(`benchmark`)
+	for i := 0; i < 5; i++ {
+		log.AddTag(fmt.Sprintf(`tag %d`, i))
+		log.SetData(fmt.Sprintf(`key %d`, i), `value`)
+		log.AddNotes(fmt.Sprintf(`group %d`, i), `step 1`, `step 2`, `step 3`)
+	}
+	log.SetData(`nested`, map[string]interface{}{`key`: `val`, `list`: []interface{}{1, 2, 3}})
+	return log.Success()
+}
+
+func BenchmarkLogSnapshot(b *testing.B) {
+	log := newBenchmarkLog()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		log.Snapshot()
+	}
+}
+
+func BenchmarkLogSnapshotEmpty(b *testing.B) {
+	log := NewLog(`benchmark`)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		log.Snapshot()
+	}
+}
+
+func BenchmarkLogToJSON(b *testing.B) {
+	log := newBenchmarkLog()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		log.ToJSON()
+	}
+}
+
+func TestLogJSONToLog(t *testing.T) {
+
+	Convey("LogJSON to Log", t, func() {
+		parent := NewLog(`parent`)
+		log, _ := parent.CreateChild(`test log`)
+		log.AddTag(`tag 1`)
+		log.AddNotes(`group`, `note 1`).AddNotes(`group`, `note 2`)
+		log.SetData(`key`, `val`)
+		log.SetEnvironment(EnvironmentProd).Fail(errors.New(`fail`)).ThreadFinish()
+
+		Convey("ToLog", func() {
+			restored, err := log.ToLogJSON().ToLog()
+
+			So(err, ShouldBeNil)
+			So(restored.ID, ShouldEqual, log.ID)
+			So(restored.Thread, ShouldEqual, log.Thread)
+			So(restored.Name, ShouldEqual, log.Name)
+			So(restored.App, ShouldEqual, log.App)
+			So(restored.Environment, ShouldEqual, EnvironmentProd)
+			So(restored.Time.UnixNano(), ShouldEqual, log.Time.UnixNano())
+			So(restored.TimeEnd.UnixNano(), ShouldEqual, log.TimeEnd.UnixNano())
+			So(restored.Result, ShouldBeFalse)
+			So(restored.Finish, ShouldBeTrue)
+			So(restored.Error.Error(), ShouldEqual, `fail`)
+			So(restored.Parent.ID, ShouldEqual, parent.ID)
+			So(restored.Parent.Thread, ShouldEqual, parent.Thread)
+			So(restored.Data().Get(`key`), ShouldEqual, `val`)
+			So(restored.Notes().Get(`group`).Count(), ShouldEqual, 2)
+			So(restored.Tags().List(), ShouldResemble, []string{`tag 1`})
+		})
+
+		Convey("ToLog of empty struct", func() {
+			restored, err := (&LogJSON{}).ToLog()
+
+			So(err, ShouldBeNil)
+			So(restored.Parent, ShouldBeNil)
+			So(restored.TimeEnd, ShouldBeNil)
+			So(restored.Error, ShouldBeNil)
+
+			restored.SetData(`key`, `val`)
+			restored.AddNotes(`group`, `note`)
+			restored.AddTag(`tag`)
+		})
+
+		Convey("ToLog with invalid parent", func() {
+			parentID := `invalid`
+			restored, err := (&LogJSON{Parent: &parentID}).ToLog()
+
+			So(err, ShouldBeError)
+			So(restored, ShouldBeNil)
+		})
+
+		Convey("Unmarshal", func() {
+			restored := &Log{}
+			err := json.Unmarshal(log.ToJSON(), restored)
+
+			So(err, ShouldBeNil)
+			So(restored.ID, ShouldEqual, log.ID)
+			So(restored.Parent.ID, ShouldEqual, parent.ID)
+			So(restored.Error.Error(), ShouldEqual, `fail`)
+
+			So(json.Unmarshal([]byte(`{"id":1}`), restored), ShouldBeError)
+			So(json.Unmarshal([]byte(`{"parent":"bad"}`), restored), ShouldBeError)
+		})
+	})
+}
+
+// randomLog is generator of random logs for property-based tests
+type randomLog struct {
+	*Log
+}
+
+func randomString(r *rand.Rand) string {
+	runes := []rune(`abcXYZ 019_-."\\/<>&ЖЯ😀\n\t`)
+	b := make([]rune, r.Intn(12))
+	for i := range b {
+		b[i] = runes[r.Intn(len(runes))]
+	}
+	return string(b)
+}
+
+func randomValue(r *rand.Rand, depth int) interface{} {
+	switch r.Intn(6) {
+	case 0:
+		return randomString(r)
+	case 1:
+		return r.Intn(2) == 0
+	case 2:
+		return float64(r.Int63n(1<<53)) - float64(r.Int63n(1<<53))
+	case 3:
+		return r.NormFloat64() * 1e6
+	case 4:
+		if depth > 0 {
+			m := make(map[string]interface{})
+			for i := r.Intn(3); i > 0; i-- {
+				m[randomString(r)] = randomValue(r, depth-1)
+			}
+			return m
+		}
+		return nil
+	default:
+		if depth > 0 {
+			list := make([]interface{}, r.Intn(3))
+			for i := range list {
+				list[i] = randomValue(r, depth-1)
+			}
+			return list
+		}
+		return nil
+	}
+}
+
+// Generate implements quick.Generator
+func (randomLog) Generate(r *rand.Rand, _ int) reflect.Value {
+	log := NewLog(randomString(r)).
+		SetApplication(randomString(r)).
+		SetEnvironment(randomString(r))
+	log.Time = time.Unix(0, r.Int63())
+
+	if r.Intn(2) == 0 {
+		parent := NewLog(`parent`)
+		log.Thread = parent.Thread
+		log.SetParentID(parent.ID)
+	}
+
+	for i := r.Intn(4); i > 0; i-- {
+		log.SetData(randomString(r), randomValue(r, 2))
+	}
+	for i := r.Intn(4); i > 0; i-- {
+		log.AddNotes(randomString(r), randomString(r))
+	}
+	for i := r.Intn(4); i > 0; i-- {
+		log.AddTag(randomString(r))
+	}
+
+	switch r.Intn(3) {
+	case 0:
+		log.Success()
+	case 1:
+		log.Fail(errors.New(randomString(r)))
+	}
+	if log.TimeEnd != nil {
+		te := time.Unix(0, r.Int63())
+		log.TimeEnd = &te
+	}
+	if r.Intn(2) == 0 {
+		log.ThreadFinish()
+	}
+
+	return reflect.ValueOf(randomLog{log})
+}
+
+func TestLogJSONRoundTripProperty(t *testing.T) {
+
+	Convey("JSON round trip is lossless", t, func() {
+		cfg := &quick.Config{MaxCount: 500}
+
+		Convey("Unmarshal", func() {
+			property := func(rl randomLog) bool {
+				restored := &Log{}
+				if err := json.Unmarshal(rl.ToJSON(), restored); err != nil {
+					return false
+				}
+				return string(restored.ToJSON()) == string(rl.ToJSON())
+			}
+
+			So(quick.Check(property, cfg), ShouldBeNil)
+		})
+
+		Convey("LogJSON.ToLog", func() {
+			property := func(rl randomLog) bool {
+				var lj LogJSON
+				if err := json.Unmarshal(rl.ToJSON(), &lj); err != nil {
+					return false
+				}
+				restored, err := lj.ToLog()
+				if err != nil {
+					return false
+				}
+
+				return string(restored.ToJSON()) == string(rl.ToJSON()) &&
+					restored.Time.Equal(rl.Time) &&
+					(restored.TimeEnd == nil) == (rl.TimeEnd == nil) &&
+					(restored.TimeEnd == nil || restored.TimeEnd.Equal(*rl.TimeEnd)) &&
+					(restored.Parent == nil) == (rl.Parent == nil) &&
+					(restored.Parent == nil || restored.Parent.ID == rl.Parent.ID)
+			}
+
+			So(quick.Check(property, cfg), ShouldBeNil)
+		})
+	})
+}
+
+func TestConcurrentMutation(t *testing.T) {
+
+	Convey("Concurrent mutation of Log", t, func() {
+		log := NewLog(`fan-out`)
+
+		const workers = 10
+		var wg sync.WaitGroup
+
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				group := fmt.Sprintf(`worker %d`, i%4)
+				for j := 0; j < 20; j++ {
+					log.AddNote(group, NewNote(fmt.Sprintf(`step %d`, j)))
+					log.SetData(fmt.Sprintf(`key %d`, i), j)
+					log.SetData(fmt.Sprintf(`nested.key %d`, i), j)
+					log.AddTag(group)
+
+					log.GetData(`key 0`)
+					log.ToJSON()
+					_ = log.String()
+				}
+
+				child, err := log.CreateChild(group)
+				if err == nil {
+					child.Fail(errors.New(`fail`))
+				}
+				log.SetName(`fan-out`)
+			}(i)
+		}
+
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					lJSON := log.ToLogJSON()
+					for _, ng := range lJSON.Notes {
+						_ = len(ng.Notes)
+					}
+					if nested, ok := log.GetData(`nested`).(map[string]interface{}); ok {
+						nested[`changed`] = true
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+		log.Success()
+
+		So(log.Notes(), ShouldHaveLength, 4)
+		So(log.Notes().Get(`worker 0`).Count(), ShouldEqual, 3*20)
+		So(log.Data().Len(), ShouldEqual, workers+1)
+		So(log.Data().Get(`nested.changed`), ShouldBeNil)
+		So(log.Tags(), ShouldHaveLength, workers*20)
+
+		lJSON := log.ToLogJSON()
+		So(len(lJSON.Notes), ShouldEqual, 4)
+		So(lJSON.Result, ShouldBeTrue)
+	})
+
+	Convey("Guarded fields of zero Log", t, func() {
+		log := &Log{}
+		log.SetData(`key`, `val`).AddNote(`group`, NewNote(`note`)).AddNote(`group`, nil).AddTag(`tag`)
+
+		So(log.GetData(`key`), ShouldEqual, `val`)
+		So(log.Notes().Get(`group`).Count(), ShouldEqual, 1)
+		So(log.Tags().List(), ShouldResemble, []string{`tag`})
+	})
+
+	Convey("Getters return copies", t, func() {
+		log := NewLog(`copies`)
+		group := NewNoteGroup(`group`).Add(`note`)
+		log.AddNoteGroup(group).AddNoteGroup(nil).AddTag(`tag`).
+			MergeData(ExtraData{`nested`: map[string]interface{}{`key`: `val`}})
+
+		group.Add(`changed`)
+		log.Data().Get(`nested`).(map[string]interface{})[`key`] = `changed`
+		log.Tags()[0] = `changed`
+		log.Notes().Get(`group`).Add(`changed`)
+
+		So(log.NoteGroup(`group`).Count(), ShouldEqual, 1)
+		So(log.GetData(`nested.key`), ShouldEqual, `val`)
+		So(log.Tags(), ShouldResemble, Tags{`tag`})
+	})
+
+	Convey("Leveled notes", t, func() {
+		log := NewLog(`leveled`)
+		log.NoteDebug(`db`, `connect`).NoteInfo(`db`, `query`, NewAttr(`rows`, 2))
+
+		SetNoteSource(true)
+		log.NoteWarn(`db`, `slow`)
+		log.NoteError(`db`, `failed`, errors.New(`timeout`))
+		SetNoteSource(false)
+
+		notes := log.NoteGroup(`db`).Notes
+		So(notes, ShouldHaveLength, 4)
+		So(notes[0].Level, ShouldEqual, LevelDebug)
+		So(notes[0].Source, ShouldBeEmpty)
+		So(notes[1].Level, ShouldEqual, LevelInfo)
+		So(notes[1].Attrs, ShouldResemble, map[string]interface{}{`rows`: 2})
+		So(notes[2].Level, ShouldEqual, LevelWarn)
+		So(notes[2].Source, ShouldContainSubstring, `/log_test.go:`)
+		So(notes[3].Level, ShouldEqual, LevelError)
+		So(notes[3].Error, ShouldEqual, `timeout`)
+		So(notes[3].Source, ShouldContainSubstring, `/log_test.go:`)
+	})
+}
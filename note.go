@@ -2,18 +2,113 @@ package tracefall
 
 import (
 	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync/atomic"
 	"time"
 )
 
-// Note struct
+// NoteLevel is severity level of Note. Empty level means the note without level (as info)
+type NoteLevel string
+
+// Note levels
+const (
+	LevelDebug NoteLevel = `debug`
+	LevelInfo  NoteLevel = `info`
+	LevelWarn  NoteLevel = `warn`
+	LevelError NoteLevel = `error`
+)
+
+// Attr is key/value attribute of Note
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// NewAttr create new Attr
+func NewAttr(key string, value interface{}) Attr {
+	return Attr{key, value}
+}
+
+// Note struct. All fields except time and text are omitted from json when empty,
+// so the notes without level and attributes keep old format: {"t":..,"v":..}
 type Note struct {
-	Time int64  `json:"t"`
-	Note string `json:"v"`
+	Time   int64                  `json:"t"`
+	Note   string                 `json:"v"`
+	Level  NoteLevel              `json:"l,omitempty"`
+	Attrs  map[string]interface{} `json:"a,omitempty"`
+	Source string                 `json:"s,omitempty"`
+	Error  string                 `json:"e,omitempty"`
 }
 
 // NewNote struct
 func NewNote(note string) *Note {
-	return &Note{time.Now().UnixNano(), note}
+	return &Note{Time: time.Now().UnixNano(), Note: note}
+}
+
+// NewLevelNote create new Note with level and attributes
+func NewLevelNote(level NoteLevel, note string, attrs ...Attr) *Note {
+	return NewNote(note).SetLevel(level).AddAttrs(attrs...)
+}
+
+// SetLevel set level of note
+func (n *Note) SetLevel(level NoteLevel) *Note {
+	n.Level = level
+	return n
+}
+
+// AddAttrs add attributes to note
+func (n *Note) AddAttrs(attrs ...Attr) *Note {
+	if len(attrs) == 0 {
+		return n
+	}
+	if n.Attrs == nil {
+		n.Attrs = make(map[string]interface{}, len(attrs))
+	}
+	for _, attr := range attrs {
+		n.Attrs[attr.Key] = attr.Value
+	}
+	return n
+}
+
+// SetError attach error to note
+func (n *Note) SetError(err error) *Note {
+	if err != nil {
+		n.Error = err.Error()
+	}
+	return n
+}
+
+// SetSource set source location of note from the caller. The argument skip is the number of stack frames
+// to ascend, with 0 identifying the caller of SetSource
+func (n *Note) SetSource(skip int) *Note {
+	if _, file, line, ok := runtime.Caller(skip + 1); ok {
+		n.Source = fmt.Sprintf(`%s:%d`, filepath.Join(filepath.Base(filepath.Dir(file)), filepath.Base(file)), line)
+	}
+	return n
+}
+
+// Copy return copy of Note
+func (n *Note) Copy() *Note {
+	c := *n
+	if n.Attrs != nil {
+		c.Attrs = copyValue(n.Attrs).(map[string]interface{})
+	}
+	return &c
+}
+
+var noteSource int32
+
+// SetNoteSource turn on (or off) capturing of source location (file:line) for notes which are added
+// by leveled helpers: Log.NoteDebug, NoteInfo, NoteWarn, NoteError and NoteGroups.Debug, Info, Warn, Error
+func SetNoteSource(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&noteSource, v)
 }
 
 // Notes list of Note
@@ -36,6 +131,16 @@ func (n *NoteGroup) Add(note string) *NoteGroup {
 	return n
 }
 
+// AddNote add Note struct to NoteGroup
+func (n *NoteGroup) AddNote(note *Note) *NoteGroup {
+	if note == nil {
+		return n
+	}
+
+	n.Notes = append(n.Notes, note)
+	return n
+}
+
 // NewNoteGroup create new NoteGroup
 func NewNoteGroup(groupLabel string) *NoteGroup {
 	return &NoteGroup{Label: groupLabel}
@@ -47,6 +152,27 @@ func (n *NoteGroup) Clear() *NoteGroup {
 	return n
 }
 
+func (n *NoteGroup) firstTime() int64 {
+	if len(n.Notes) == 0 || n.Notes[0] == nil {
+		return 0
+	}
+	return n.Notes[0].Time
+}
+
+// Copy return copy of NoteGroup
+func (n *NoteGroup) Copy() *NoteGroup {
+	group := &NoteGroup{Label: n.Label}
+	if n.Notes != nil {
+		group.Notes = make(Notes, len(n.Notes))
+		for i, note := range n.Notes {
+			if note != nil {
+				group.Notes[i] = note.Copy()
+			}
+		}
+	}
+	return group
+}
+
 // NoteGroupList is list of NoteGroup
 type NoteGroupList []*NoteGroup
 
@@ -55,7 +181,26 @@ func (n *NoteGroupList) FromJSON(b []byte) error {
 	return json.Unmarshal(b, n)
 }
 
-// NoteGroups is list of NoteGroup
+// ToJSON get json from list
+func (n NoteGroupList) ToJSON() []byte {
+	b, err := json.Marshal(n)
+	if err != nil {
+		b = []byte(`[]`)
+	}
+	return b
+}
+
+// Get return group by label, nil if it is absent
+func (n NoteGroupList) Get(label string) *NoteGroup {
+	for _, group := range n {
+		if group != nil && group.Label == label {
+			return group
+		}
+	}
+	return nil
+}
+
+// NoteGroups is list of NoteGroup. It is not safe for concurrent use: notes of Log are changed only by its methods (AddNote, AddNotes, ...)
 type NoteGroups map[string]*NoteGroup
 
 // Count elements in NoteGroups
@@ -70,14 +215,59 @@ func NewNotesGroups() NoteGroups {
 
 // Add new note to exist group (or create new if absent) in NoteGroups
 func (n NoteGroups) Add(group, note string) NoteGroups {
-	if lg, ok := n[group]; ok {
-		n[group] = lg.Add(note)
-	} else {
-		n[group] = NewNoteGroup(group).Add(note)
+	n.group(group).Add(note)
+	return n
+}
+
+func (n NoteGroups) group(group string) *NoteGroup {
+	lg, ok := n[group]
+	if !ok {
+		lg = NewNoteGroup(group)
+		n[group] = lg
 	}
+	return lg
+}
+
+// AddNote add Note struct to exist group (or create new if absent) in NoteGroups
+func (n NoteGroups) AddNote(group string, note *Note) NoteGroups {
+	n.group(group).AddNote(note)
 	return n
 }
 
+// Debug add note with debug level to group
+func (n NoteGroups) Debug(group, note string, attrs ...Attr) NoteGroups {
+	return n.addLevel(group, LevelDebug, note, nil, attrs)
+}
+
+// Info add note with info level to group
+func (n NoteGroups) Info(group, note string, attrs ...Attr) NoteGroups {
+	return n.addLevel(group, LevelInfo, note, nil, attrs)
+}
+
+// Warn add note with warn level to group
+func (n NoteGroups) Warn(group, note string, attrs ...Attr) NoteGroups {
+	return n.addLevel(group, LevelWarn, note, nil, attrs)
+}
+
+// Error add note with error level and attached error to group
+func (n NoteGroups) Error(group, note string, err error, attrs ...Attr) NoteGroups {
+	return n.addLevel(group, LevelError, note, err, attrs)
+}
+
+func (n NoteGroups) addLevel(group string, level NoteLevel, msg string, err error, attrs []Attr) NoteGroups {
+	return n.AddNote(group, levelNote(level, msg, err, attrs, 2))
+}
+
+// levelNote create note of leveled helpers. The argument skip is the number of stack frames
+// to ascend for the source location, with 0 identifying the caller of levelNote
+func levelNote(level NoteLevel, msg string, err error, attrs []Attr, skip int) *Note {
+	note := NewLevelNote(level, msg, attrs...).SetError(err)
+	if atomic.LoadInt32(&noteSource) == 1 {
+		note.SetSource(skip + 1)
+	}
+	return note
+}
+
 // AddGroup add notes list to exist group (or create new if absent) in NoteGroups
 func (n NoteGroups) AddGroup(group string, notes []string) NoteGroups {
 	for _, note := range notes {
@@ -125,14 +315,50 @@ func (n NoteGroups) ToJSON() []byte {
 	return b
 }
 
+// List return copies of groups ordered by the time of the first note in group (then by label).
+// Groups without notes go first
+func (n NoteGroups) List() NoteGroupList {
+	return n.prepareToJSON()
+}
+
 func (n NoteGroups) prepareToJSON() NoteGroupList {
 	var list NoteGroupList
+	for _, ng := range n.groups() {
+		list = append(list, ng.Copy())
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		ti, tj := list[i].firstTime(), list[j].firstTime()
+		if ti != tj {
+			return ti < tj
+		}
+		return list[i].Label < list[j].Label
+	})
+
+	return list
+}
+
+func (n NoteGroups) groups() []*NoteGroup {
+	list := make([]*NoteGroup, 0, len(n))
 	for _, ng := range n {
 		list = append(list, ng)
 	}
 	return list
 }
 
+// Copy return deep copy of NoteGroups
+func (n NoteGroups) Copy() NoteGroups {
+	if n == nil {
+		return nil
+	}
+
+	groups := NewNotesGroups()
+	for _, ng := range n.groups() {
+		groups[ng.Label] = ng.Copy()
+	}
+	return groups
+}
+
 // ToJSONString return json string of NoteGroups
 func (n NoteGroups) ToJSONString() string {
 	return string(n.ToJSON())
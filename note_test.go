@@ -2,6 +2,7 @@ package tracefall
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -22,6 +23,24 @@ func TestNote(t *testing.T) {
 
 		So(note.Time, ShouldBeGreaterThanOrEqualTo, timeStart.UnixNano())
 		So(note.Time, ShouldBeLessThan, time.Now().UnixNano())
+		So(note.Level, ShouldBeEmpty)
+	})
+
+	Convey("Leveled Note", t, func() {
+		note := NewLevelNote(LevelWarn, `slow query`, NewAttr(`ms`, 1200), NewAttr(`table`, `users`)).
+			SetError(errors.New(`timeout`)).
+			SetSource(0)
+
+		So(note.Level, ShouldEqual, LevelWarn)
+		So(note.Attrs, ShouldResemble, map[string]interface{}{`ms`: 1200, `table`: `users`})
+		So(note.Error, ShouldEqual, `timeout`)
+		So(note.Source, ShouldContainSubstring, `/note_test.go:`)
+
+		c := note.Copy()
+		c.Attrs[`ms`] = 1
+		So(note.Attrs[`ms`], ShouldEqual, 1200)
+
+		So(NewNote(`note`).SetError(nil).Error, ShouldBeEmpty)
 	})
 }
 
@@ -186,5 +205,86 @@ func TestNoteGroups(t *testing.T) {
 
 			So(groupsToJson, ShouldResemble, groupsFromJson)
 		})
+
+		Convey("Order", func() {
+			groups.
+				Add(`second`, `note 1`).
+				Add(`first`, `note 1`).
+				Add(`third`, `note 1`).
+				Add(`second`, `note 2`)
+			groups.AddNoteGroup(NewNoteGroup(`empty`))
+
+			labels := func(list NoteGroupList) []string {
+				var res []string
+				for _, ng := range list {
+					res = append(res, ng.Label)
+				}
+				return res
+			}
+
+			So(labels(groups.List()), ShouldResemble, []string{`empty`, `second`, `first`, `third`})
+
+			jsonBytes := groups.ToJSON()
+			for i := 0; i < 20; i++ {
+				So(string(groups.ToJSON()), ShouldEqual, string(jsonBytes))
+			}
+
+			groupsFromJson := NewNotesGroups()
+			So(groupsFromJson.FromJSON(jsonBytes), ShouldBeNil)
+			So(string(groupsFromJson.ToJSON()), ShouldEqual, string(jsonBytes))
+			So(labels(groupsFromJson.Copy().List()), ShouldResemble, []string{`empty`, `second`, `first`, `third`})
+		})
+
+		Convey("Order by label for the same time", func() {
+			for _, label := range []string{`c`, `a`, `b`} {
+				groups.AddNoteGroup(&NoteGroup{Label: label, Notes: Notes{{Time: 1, Note: `note`}}})
+			}
+
+			list := groups.List()
+			So(list[0].Label, ShouldEqual, `a`)
+			So(list[1].Label, ShouldEqual, `b`)
+			So(list[2].Label, ShouldEqual, `c`)
+		})
+
+		Convey("Leveled", func() {
+			groups.
+				Debug(`db`, `connect`).
+				Info(`db`, `query`, NewAttr(`rows`, 2)).
+				Warn(`db`, `slow`, NewAttr(`ms`, 1200)).
+				Error(`db`, `failed`, errors.New(`timeout`), NewAttr(`retry`, true))
+
+			notes := groups.Get(`db`).Notes
+			So(len(notes), ShouldEqual, 4)
+			So(notes[0].Level, ShouldEqual, LevelDebug)
+			So(notes[1].Level, ShouldEqual, LevelInfo)
+			So(notes[1].Attrs[`rows`], ShouldEqual, 2)
+			So(notes[2].Level, ShouldEqual, LevelWarn)
+			So(notes[3].Level, ShouldEqual, LevelError)
+			So(notes[3].Error, ShouldEqual, `timeout`)
+			So(notes[3].Attrs[`retry`], ShouldBeTrue)
+			So(notes[3].Source, ShouldBeEmpty)
+
+			SetNoteSource(true)
+			defer SetNoteSource(false)
+			groups.Warn(`db`, `with source`)
+			So(groups.Get(`db`).Notes[4].Source, ShouldContainSubstring, `/note_test.go:`)
+
+			groupsFromJson := NewNotesGroups()
+			So(groupsFromJson.FromJSON(groups.ToJSON()), ShouldBeNil)
+
+			restored := groupsFromJson.Get(`db`).Notes
+			So(restored[2].Level, ShouldEqual, LevelWarn)
+			So(restored[2].Attrs[`ms`], ShouldEqual, 1200)
+			So(restored[3].Error, ShouldEqual, `timeout`)
+			So(restored[4].Source, ShouldEqual, groups.Get(`db`).Notes[4].Source)
+		})
+
+		Convey("Old json format", func() {
+			So(groups.FromJSON([]byte(`[{"notes":[{"t":1,"v":"old note"}],"label":"old"}]`)), ShouldBeNil)
+
+			note := groups.Get(`old`).Notes[0]
+			So(note, ShouldResemble, &Note{Time: 1, Note: `old note`})
+			So(string(groups.ToJSON()), ShouldEqual, `[{"notes":[{"t":1,"v":"old note"}],"label":"old"}]`)
+		})
 	})
 }
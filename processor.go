@@ -0,0 +1,141 @@
+package tracefall
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Processor intercepts lifecycle of logs. Processors are called in order of registration:
+// global ones (see AddProcessor) first, then processors of DB (see DB.AddProcessor).
+// OnCreate, OnChildCreated and OnFinish are called only for global processors, because the log is not bound to DB
+// until it is sent. Errors and panics of processors are passed to the error handler (see SetProcessorErrorHandler)
+// and do not break the chain and sending
+type Processor interface {
+	// OnCreate is called for every new log: root and child
+	OnCreate(l *Log)
+	// OnChildCreated is called when child is created, after OnCreate of the child
+	OnChildCreated(parent, child *Log)
+	// OnFinish is called when the log is finished by Success or Fail
+	OnFinish(l *Log)
+	// OnSend is called before the log is sent to driver
+	OnSend(e *SendEvent) error
+}
+
+// SendEvent is passed to processors before the log is sent. Processors may change the log,
+// reroute it to another driver or drop it
+type SendEvent struct {
+	// Log is snapshot which is sent
+	Log *Log
+	// Driver which the log is sent to
+	Driver Driver
+	// Drop filters the log out: it is not sent, further processors are not called
+	Drop bool
+}
+
+// BaseProcessor implements Processor with methods which do nothing. Embed it to implement only needed methods
+type BaseProcessor struct{}
+
+// OnCreate implements Processor
+func (BaseProcessor) OnCreate(*Log) {}
+
+// OnChildCreated implements Processor
+func (BaseProcessor) OnChildCreated(*Log, *Log) {}
+
+// OnFinish implements Processor
+func (BaseProcessor) OnFinish(*Log) {}
+
+// OnSend implements Processor
+func (BaseProcessor) OnSend(*SendEvent) error { return nil }
+
+// processors is ordered list of processors. Lists are never changed, new list is made on adding
+type processors []Processor
+
+func (list processors) add(p Processor) processors {
+	res := make(processors, 0, len(list)+1)
+	return append(append(res, list...), p)
+}
+
+var (
+	globalProcessors   processors
+	processorsMu       sync.RWMutex
+	processorErrorFunc func(p Processor, err error)
+)
+
+// AddProcessor add global processor
+func AddProcessor(p Processor) {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+
+	globalProcessors = globalProcessors.add(p)
+}
+
+// SetProcessorErrorHandler set handler of errors and panics of processors
+func SetProcessorErrorHandler(fn func(p Processor, err error)) {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+
+	processorErrorFunc = fn
+}
+
+func removeAllProcessors() {
+	processorsMu.Lock()
+	defer processorsMu.Unlock()
+	// For tests.
+	globalProcessors = nil
+	processorErrorFunc = nil
+}
+
+func getProcessors() processors {
+	processorsMu.RLock()
+	defer processorsMu.RUnlock()
+
+	return globalProcessors
+}
+
+func processorError(p Processor, err error) {
+	processorsMu.RLock()
+	fn := processorErrorFunc
+	processorsMu.RUnlock()
+
+	if fn != nil && err != nil {
+		fn(p, err)
+	}
+}
+
+// call run fn of processor. Panic is converted to error
+func call(p Processor, fn func() error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			processorError(p, fmt.Errorf(`processor panic: %v`, rec))
+		}
+	}()
+
+	processorError(p, fn())
+}
+
+func (list processors) onCreate(l *Log) {
+	for _, p := range list {
+		call(p, func() error { p.OnCreate(l); return nil })
+	}
+}
+
+func (list processors) onChildCreated(parent, child *Log) {
+	for _, p := range list {
+		call(p, func() error { p.OnChildCreated(parent, child); return nil })
+	}
+}
+
+func (list processors) onFinish(l *Log) {
+	for _, p := range list {
+		call(p, func() error { p.OnFinish(l); return nil })
+	}
+}
+
+func (list processors) onSend(e *SendEvent) {
+	for _, p := range list {
+		call(p, func() error { return p.OnSend(e) })
+		if e.Drop {
+			return
+		}
+	}
+}
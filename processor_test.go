@@ -0,0 +1,200 @@
+package tracefall
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordProcessor struct {
+	name   string
+	mu     sync.Mutex
+	events []string
+}
+
+func (p *recordProcessor) record(event string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+}
+
+func (p *recordProcessor) OnCreate(l *Log) {
+	p.record(`create ` + l.Name)
+}
+
+func (p *recordProcessor) OnChildCreated(parent, child *Log) {
+	p.record(`child ` + parent.Name + `/` + child.Name)
+}
+
+func (p *recordProcessor) OnFinish(l *Log) {
+	p.record(`finish ` + l.Name)
+}
+
+func (p *recordProcessor) OnSend(e *SendEvent) error {
+	p.record(p.name + ` send ` + e.Log.Name)
+	return nil
+}
+
+type enrichProcessor struct {
+	BaseProcessor
+}
+
+func (enrichProcessor) OnCreate(l *Log) {
+	l.AddTag(`pod-1`)
+}
+
+func (enrichProcessor) OnSend(e *SendEvent) error {
+	e.Log.SetData(`host`, `localhost`)
+	return nil
+}
+
+type sendFunc func(e *SendEvent) error
+
+func (f sendFunc) OnCreate(*Log)             {}
+func (f sendFunc) OnChildCreated(*Log, *Log) {}
+func (f sendFunc) OnFinish(*Log)             {}
+func (f sendFunc) OnSend(e *SendEvent) error { return f(e) }
+
+func TestProcessors(t *testing.T) {
+
+	Convey("Processors", t, func() {
+		defer removeAllProcessors()
+
+		drv := &recordDriver{}
+		db, err := OpenDB(drvConnector{driver: drv})
+		So(err, ShouldBeNil)
+
+		Convey("Lifecycle", func() {
+			global := &recordProcessor{name: `global`}
+			local := &recordProcessor{name: `db`}
+			AddProcessor(global)
+			db.AddProcessor(local)
+
+			root := NewLog(`root`)
+			child, _ := root.CreateChild(`child`)
+			child.Fail(errors.New(`fail`))
+			root.Success()
+			_, _ = db.Send(root)
+
+			So(global.events, ShouldResemble, []string{
+				`create root`,
+				`create child`,
+				`child root/child`,
+				`finish child`,
+				`finish root`,
+				`global send root`,
+			})
+			So(local.events, ShouldResemble, []string{`db send root`})
+		})
+
+		Convey("Enrich", func() {
+			AddProcessor(enrichProcessor{})
+
+			log := NewLog(`root`)
+			So(log.Tags().List(), ShouldResemble, []string{`pod-1`})
+
+			_, _ = db.Send(log)
+			So(drv.logs[0].Data().Get(`host`), ShouldEqual, `localhost`)
+			So(log.Data().Get(`host`), ShouldBeNil)
+		})
+
+		Convey("Filter", func() {
+			rec := &recordProcessor{name: `after`}
+			db.AddProcessor(sendFunc(func(e *SendEvent) error {
+				e.Drop = e.Log.Name == `health`
+				return nil
+			})).AddProcessor(rec)
+
+			r, err := db.Send(NewLog(`health`))
+			So(err, ShouldBeNil)
+			So(r.Result, ShouldBeTrue)
+			_, _ = db.Send(NewLog(`request`))
+
+			So(drv.names(), ShouldResemble, []string{`request`})
+			So(rec.events, ShouldResemble, []string{`after send request`})
+		})
+
+		Convey("Transform and reroute", func() {
+			audit := &recordDriver{}
+			db.AddProcessor(sendFunc(func(e *SendEvent) error {
+				e.Log.Name = `[audit] ` + e.Log.Name
+				if len(e.Log.Tags().List()) > 0 {
+					e.Driver = audit
+				}
+				return nil
+			}))
+
+			log := NewLog(`login`)
+			log.AddTag(`audit`)
+			_, _ = db.Send(log)
+			_, _ = db.Send(NewLog(`request`))
+
+			So(audit.names(), ShouldResemble, []string{`[audit] login`})
+			So(drv.names(), ShouldResemble, []string{`[audit] request`})
+		})
+
+		Convey("Processors see redacted snapshot", func() {
+			var seen []interface{}
+			db.SetRedactor(NewRedactor().DenyKeys(`password`))
+			db.AddProcessor(sendFunc(func(e *SendEvent) error {
+				seen = append(seen, e.Log.Data().Get(`password`))
+				return nil
+			}))
+
+			log := NewLog(`login`)
+			log.SetData(`password`, `secret`)
+			_, _ = db.Send(log)
+
+			So(seen, ShouldResemble, []interface{}{DefaultRedactMask})
+			So(drv.logs[0].Data().Get(`password`), ShouldEqual, DefaultRedactMask)
+		})
+
+		Convey("Failures are isolated", func() {
+			var errs []string
+			SetProcessorErrorHandler(func(p Processor, err error) {
+				errs = append(errs, err.Error())
+			})
+
+			db.
+				AddProcessor(sendFunc(func(e *SendEvent) error { return errors.New(`broken`) })).
+				AddProcessor(sendFunc(func(e *SendEvent) error { panic(`boom`) })).
+				AddProcessor(enrichProcessor{})
+
+			AddProcessor(sendFunc(func(e *SendEvent) error { return nil }))
+			AddProcessor(panicProcessor{})
+
+			log := NewLog(`root`)
+			child, err := log.CreateChild(`child`)
+			So(err, ShouldBeNil)
+			child.Success()
+
+			r, err := db.Send(log)
+			So(err, ShouldBeNil)
+			So(r.Result, ShouldBeTrue)
+			So(drv.logs[0].Data().Get(`host`), ShouldEqual, `localhost`)
+
+			So(errs, ShouldResemble, []string{
+				`processor panic: create root`,
+				`processor panic: create child`,
+				`processor panic: finish child`,
+				`broken`,
+				`processor panic: boom`,
+			})
+		})
+	})
+}
+
+type panicProcessor struct {
+	BaseProcessor
+}
+
+func (panicProcessor) OnCreate(l *Log) {
+	panic(fmt.Sprintf(`create %s`, l.Name))
+}
+
+func (panicProcessor) OnFinish(l *Log) {
+	panic(fmt.Sprintf(`finish %s`, l.Name))
+}
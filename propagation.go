@@ -0,0 +1,375 @@
+package tracefall
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// TextMapCarrier is storage of propagation fields: http headers, message headers, etc.
+type TextMapCarrier interface {
+	Get(key string) string
+	Set(key, value string)
+	Keys() []string
+}
+
+// HeaderCarrier adapts http.Header to TextMapCarrier
+type HeaderCarrier http.Header
+
+// Get return value by key
+func (h HeaderCarrier) Get(key string) string {
+	return http.Header(h).Get(key)
+}
+
+// Set value by key
+func (h HeaderCarrier) Set(key, value string) {
+	http.Header(h).Set(key, value)
+}
+
+// Keys return list of keys
+func (h HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// MapCarrier adapts map[string]string to TextMapCarrier. Keys are matched case-insensitive on Get
+type MapCarrier map[string]string
+
+// Get return value by key
+func (m MapCarrier) Get(key string) string {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ``
+}
+
+// Set value by key
+func (m MapCarrier) Set(key, value string) {
+	m[key] = value
+}
+
+// Keys return list of keys
+func (m MapCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Propagator injects LogParentShadow to carrier and extracts it back
+type Propagator interface {
+	Inject(shadow *LogParentShadow, carrier TextMapCarrier)
+	Extract(carrier TextMapCarrier) (*LogParentShadow, error)
+	Fields() []string
+}
+
+// ErrorShadowNotFound error
+var ErrorShadowNotFound = errors.New(`the carrier does not contain a parent shadow`)
+
+// ErrorShadowInvalid error
+var ErrorShadowInvalid = errors.New(`the carrier contains an invalid parent shadow`)
+
+// Propagation header names
+const (
+	HeaderTraceParent = `traceparent`
+	HeaderTraceState  = `tracestate`
+	HeaderB3          = `b3`
+	HeaderB3TraceID   = `X-B3-TraceId`
+	HeaderB3SpanID    = `X-B3-SpanId`
+	HeaderB3Sampled   = `X-B3-Sampled`
+
+	traceStateKey      = `tracefall`
+	traceParentVersion = `00`
+	traceFlagsSampled  = `01`
+	traceFlagsDropped  = `00`
+)
+
+func traceFlags(d SamplingDecision) string {
+	if d.Sampled() {
+		return traceFlagsSampled
+	}
+	return traceFlagsDropped
+}
+
+func b3Sampled(d SamplingDecision) string {
+	if d.Sampled() {
+		return `1`
+	}
+	return `0`
+}
+
+func b3Decision(sampled string) SamplingDecision {
+	switch strings.ToLower(sampled) {
+	case `1`, `d`, `true`:
+		return SamplingKeep
+	case `0`, `false`:
+		return SamplingDrop
+	default:
+		return SamplingUndecided
+	}
+}
+
+// TraceContext is W3C Trace Context propagator.
+// Thread is mapped to trace-id, Log ID to parent-id. The parent-id has only 8 bytes,
+// so the full Log ID is passed through tracestate under `tracefall` key
+type TraceContext struct{}
+
+// Inject shadow to carrier
+func (p TraceContext) Inject(shadow *LogParentShadow, carrier TextMapCarrier) {
+	if shadow == nil {
+		return
+	}
+
+	carrier.Set(HeaderTraceParent, traceParentVersion+`-`+hex.EncodeToString(shadow.Thread.Bytes())+`-`+
+		hex.EncodeToString(spanID(shadow.ID))+`-`+traceFlags(shadow.Sampling))
+
+	state := []string{traceStateKey + `=` + hex.EncodeToString(shadow.ID.Bytes())}
+	for _, member := range splitTraceState(carrier.Get(HeaderTraceState)) {
+		if !strings.HasPrefix(member, traceStateKey+`=`) {
+			state = append(state, member)
+		}
+	}
+	carrier.Set(HeaderTraceState, strings.Join(state, `,`))
+}
+
+// Extract shadow from carrier
+func (p TraceContext) Extract(carrier TextMapCarrier) (*LogParentShadow, error) {
+	header := strings.TrimSpace(carrier.Get(HeaderTraceParent))
+	if header == `` {
+		return nil, ErrorShadowNotFound
+	}
+
+	parts := strings.Split(header, `-`)
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == `ff` || (parts[0] == traceParentVersion && len(parts) != 4) {
+		return nil, ErrorShadowInvalid
+	}
+
+	thread, err := traceIDFromHex(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	span, err := decodeHex(parts[2], 8)
+	if err != nil {
+		return nil, err
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return nil, ErrorShadowInvalid
+	}
+	sampling := SamplingDrop
+	if flags[0]&1 == 1 {
+		sampling = SamplingKeep
+	}
+
+	id := idFromSpan(span)
+	for _, member := range splitTraceState(carrier.Get(HeaderTraceState)) {
+		if !strings.HasPrefix(member, traceStateKey+`=`) {
+			continue
+		}
+		full, err := traceIDFromHex(strings.TrimPrefix(member, traceStateKey+`=`))
+		if err == nil && hex.EncodeToString(spanID(full)) == parts[2] {
+			id = full
+		}
+		break
+	}
+
+	return &LogParentShadow{ID: id, Thread: thread, Sampling: sampling}, nil
+}
+
+// Fields return header names used by propagator
+func (p TraceContext) Fields() []string {
+	return []string{HeaderTraceParent, HeaderTraceState}
+}
+
+// B3 is Zipkin B3 propagator. Thread is mapped to trace ID, Log ID to span ID (last 8 bytes).
+// Inject writes single `b3` header if SingleHeader is set or multi X-B3-* headers otherwise.
+// Extract accepts both forms and headers with sampling decision only (`b3: 0`): the shadow has no IDs then.
+// B3 has no place for the full Log ID, so parent ID of extracted shadow has only the last 8 bytes (and thread
+// of 8 bytes trace ID is padded by zeros): such parent is not found by ID in storage (GetLog, GetThread).
+// Use it with TraceContext (see DefaultPropagator) between tracefall services, then TraceContext restores the full ID
+type B3 struct {
+	SingleHeader bool
+}
+
+// Inject shadow to carrier
+func (p B3) Inject(shadow *LogParentShadow, carrier TextMapCarrier) {
+	if shadow == nil {
+		return
+	}
+
+	traceID := hex.EncodeToString(shadow.Thread.Bytes())
+	span := hex.EncodeToString(spanID(shadow.ID))
+
+	if p.SingleHeader {
+		carrier.Set(HeaderB3, traceID+`-`+span+`-`+b3Sampled(shadow.Sampling))
+		return
+	}
+
+	carrier.Set(HeaderB3TraceID, traceID)
+	carrier.Set(HeaderB3SpanID, span)
+	carrier.Set(HeaderB3Sampled, b3Sampled(shadow.Sampling))
+}
+
+// Extract shadow from carrier
+func (p B3) Extract(carrier TextMapCarrier) (*LogParentShadow, error) {
+	var traceID, span, sampled string
+
+	if single := strings.TrimSpace(carrier.Get(HeaderB3)); single != `` {
+		parts := strings.Split(single, `-`)
+		if len(parts) == 1 {
+			return samplingShadow(single)
+		}
+		traceID, span = parts[0], parts[1]
+		if len(parts) > 2 {
+			sampled = parts[2]
+		}
+	} else {
+		traceID = strings.TrimSpace(carrier.Get(HeaderB3TraceID))
+		span = strings.TrimSpace(carrier.Get(HeaderB3SpanID))
+		sampled = strings.TrimSpace(carrier.Get(HeaderB3Sampled))
+		if traceID == `` && span == `` {
+			if sampled != `` {
+				return samplingShadow(sampled)
+			}
+			return nil, ErrorShadowNotFound
+		}
+	}
+
+	if len(traceID) == 16 {
+		traceID = strings.Repeat(`0`, 16) + traceID
+	}
+
+	thread, err := traceIDFromHex(traceID)
+	if err != nil {
+		return nil, err
+	}
+
+	spanBytes, err := decodeHex(span, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogParentShadow{ID: idFromSpan(spanBytes), Thread: thread, Sampling: b3Decision(sampled)}, nil
+}
+
+// samplingShadow return shadow of B3 headers which have sampling decision only
+func samplingShadow(sampled string) (*LogParentShadow, error) {
+	decision := b3Decision(sampled)
+	if decision == SamplingUndecided {
+		return nil, ErrorShadowInvalid
+	}
+	return &LogParentShadow{Sampling: decision}, nil
+}
+
+// Fields return header names used by propagator
+func (p B3) Fields() []string {
+	if p.SingleHeader {
+		return []string{HeaderB3}
+	}
+	return []string{HeaderB3TraceID, HeaderB3SpanID, HeaderB3Sampled}
+}
+
+// CompositePropagator injects by all propagators and extracts by the first successful one
+type CompositePropagator []Propagator
+
+// NewCompositePropagator create new CompositePropagator
+func NewCompositePropagator(propagators ...Propagator) CompositePropagator {
+	return CompositePropagator(propagators)
+}
+
+// Inject shadow to carrier
+func (c CompositePropagator) Inject(shadow *LogParentShadow, carrier TextMapCarrier) {
+	for _, p := range c {
+		p.Inject(shadow, carrier)
+	}
+}
+
+// Extract shadow from carrier
+func (c CompositePropagator) Extract(carrier TextMapCarrier) (*LogParentShadow, error) {
+	err := ErrorShadowNotFound
+	for _, p := range c {
+		shadow, e := p.Extract(carrier)
+		if e == nil {
+			return shadow, nil
+		}
+		if e != ErrorShadowNotFound {
+			err = e
+		}
+	}
+	return nil, err
+}
+
+// Fields return header names used by propagators
+func (c CompositePropagator) Fields() []string {
+	var fields []string
+	for _, p := range c {
+		fields = append(fields, p.Fields()...)
+	}
+	return removeDuplicatesFromSlice(fields)
+}
+
+// DefaultPropagator return propagator which injects W3C and B3 multi headers
+func DefaultPropagator() Propagator {
+	return NewCompositePropagator(TraceContext{}, B3{})
+}
+
+func spanID(id uuid.UUID) []byte {
+	return id.Bytes()[8:]
+}
+
+func idFromSpan(span []byte) uuid.UUID {
+	var id uuid.UUID
+	copy(id[8:], span)
+	return id
+}
+
+func traceIDFromHex(s string) (uuid.UUID, error) {
+	b, err := decodeHex(s, 16)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.FromBytes(b)
+}
+
+func decodeHex(s string, size int) ([]byte, error) {
+	if len(s) != size*2 || strings.ToLower(s) != s {
+		return nil, ErrorShadowInvalid
+	}
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ErrorShadowInvalid
+	}
+
+	for _, v := range b {
+		if v != 0 {
+			return b, nil
+		}
+	}
+
+	return nil, ErrorShadowInvalid
+}
+
+func splitTraceState(state string) []string {
+	var list []string
+	for _, member := range strings.Split(state, `,`) {
+		if member = strings.TrimSpace(member); member != `` {
+			list = append(list, member)
+		}
+	}
+	return list
+}
@@ -0,0 +1,280 @@
+package tracefall
+
+import (
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCarriers(t *testing.T) {
+
+	Convey("Carriers", t, func() {
+
+		Convey("Header Carrier", func() {
+			h := http.Header{}
+			c := HeaderCarrier(h)
+			c.Set(`traceparent`, `value`)
+
+			So(h.Get(`Traceparent`), ShouldEqual, `value`)
+			So(c.Get(`TRACEPARENT`), ShouldEqual, `value`)
+			So(c.Keys(), ShouldResemble, []string{`Traceparent`})
+		})
+
+		Convey("Map Carrier", func() {
+			m := map[string]string{`x-b3-traceid`: `value`}
+			c := MapCarrier(m)
+			c.Set(`key`, `val`)
+
+			So(m[`key`], ShouldEqual, `val`)
+			So(c.Get(`X-B3-TraceId`), ShouldEqual, `value`)
+			So(c.Get(`absent`), ShouldBeEmpty)
+			So(len(c.Keys()), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestTraceContextPropagator(t *testing.T) {
+
+	Convey("W3C Trace Context", t, func() {
+		log := NewLog(`test log`)
+		child, _ := log.CreateChild(`child`)
+		shadow := child.ToShadow()
+		p := TraceContext{}
+
+		Convey("Inject", func() {
+			c := MapCarrier{}
+			p.Inject(shadow, c)
+
+			So(c.Get(HeaderTraceParent), ShouldEqual, `00-`+hex.EncodeToString(log.Thread.Bytes())+`-`+
+				hex.EncodeToString(child.ID.Bytes()[8:])+`-01`)
+			So(c.Get(HeaderTraceState), ShouldEqual, `tracefall=`+hex.EncodeToString(child.ID.Bytes()))
+
+			p.Inject(nil, c)
+			So(len(c), ShouldEqual, 2)
+		})
+
+		Convey("Inject keeps foreign tracestate", func() {
+			c := MapCarrier{HeaderTraceState: `congo=t61rcWkgMzE,tracefall=00`}
+			p.Inject(shadow, c)
+
+			So(c.Get(HeaderTraceState), ShouldEqual, `tracefall=`+hex.EncodeToString(child.ID.Bytes())+`,congo=t61rcWkgMzE`)
+		})
+
+		Convey("Round trip", func() {
+			c := HeaderCarrier(http.Header{})
+			p.Inject(shadow, c)
+
+			res, err := p.Extract(c)
+			So(err, ShouldBeNil)
+			So(res.ID, ShouldEqual, shadow.ID)
+			So(res.Thread, ShouldEqual, shadow.Thread)
+			So(res.Sampling, ShouldEqual, SamplingKeep)
+		})
+
+		Convey("Sampling flag", func() {
+			c := MapCarrier{}
+			dropped := *shadow
+			dropped.Sampling = SamplingDrop
+			p.Inject(&dropped, c)
+
+			So(c.Get(HeaderTraceParent), ShouldEndWith, `-00`)
+
+			res, err := p.Extract(c)
+			So(err, ShouldBeNil)
+			So(res, ShouldResemble, &dropped)
+
+			res, err = p.Extract(MapCarrier{HeaderTraceParent: `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-03`})
+			So(err, ShouldBeNil)
+			So(res.Sampling, ShouldEqual, SamplingKeep)
+
+			_, err = p.Extract(MapCarrier{HeaderTraceParent: `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-x1`})
+			So(err, ShouldEqual, ErrorShadowInvalid)
+		})
+
+		Convey("Extract foreign traceparent", func() {
+			c := MapCarrier{HeaderTraceParent: `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`}
+
+			res, err := p.Extract(c)
+			So(err, ShouldBeNil)
+			So(hex.EncodeToString(res.Thread.Bytes()), ShouldEqual, `4bf92f3577b34da6a3ce929d0e0e4736`)
+			So(hex.EncodeToString(res.ID.Bytes()), ShouldEqual, `000000000000000000f067aa0ba902b7`)
+		})
+
+		Convey("Extract ignores tracestate of another parent", func() {
+			c := MapCarrier{
+				HeaderTraceParent: `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`,
+				HeaderTraceState:  `tracefall=` + hex.EncodeToString(child.ID.Bytes()),
+			}
+
+			res, err := p.Extract(c)
+			So(err, ShouldBeNil)
+			So(res.ID, ShouldNotEqual, child.ID)
+		})
+
+		Convey("Extract: errors", func() {
+			_, err := p.Extract(MapCarrier{})
+			So(err, ShouldEqual, ErrorShadowNotFound)
+
+			for _, header := range []string{
+				`00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7`,
+				`ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`,
+				`00-00000000000000000000000000000000-00f067aa0ba902b7-01`,
+				`00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01`,
+				`00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01`,
+				`00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01`,
+				`00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra`,
+			} {
+				_, err := p.Extract(MapCarrier{HeaderTraceParent: header})
+				So(err, ShouldEqual, ErrorShadowInvalid)
+			}
+		})
+	})
+}
+
+func TestB3Propagator(t *testing.T) {
+
+	Convey("B3", t, func() {
+		log := NewLog(`test log`)
+		shadow := log.ToShadow()
+		traceID := hex.EncodeToString(log.Thread.Bytes())
+		span := hex.EncodeToString(log.ID.Bytes()[8:])
+
+		Convey("Multi headers", func() {
+			c := HeaderCarrier(http.Header{})
+			B3{}.Inject(shadow, c)
+
+			So(c.Get(HeaderB3TraceID), ShouldEqual, traceID)
+			So(c.Get(HeaderB3SpanID), ShouldEqual, span)
+			So(c.Get(HeaderB3Sampled), ShouldEqual, `1`)
+
+			res, err := B3{}.Extract(c)
+			So(err, ShouldBeNil)
+			So(res.Thread, ShouldEqual, log.Thread)
+			So(res.ID.Bytes()[8:], ShouldResemble, log.ID.Bytes()[8:])
+		})
+
+		Convey("Single header", func() {
+			c := MapCarrier{}
+			B3{SingleHeader: true}.Inject(shadow, c)
+
+			So(c.Get(HeaderB3), ShouldEqual, traceID+`-`+span+`-1`)
+
+			res, err := B3{}.Extract(c)
+			So(err, ShouldBeNil)
+			So(res.Thread, ShouldEqual, log.Thread)
+		})
+
+		Convey("64 bit trace ID", func() {
+			res, err := B3{}.Extract(MapCarrier{`b3`: `a3ce929d0e0e4736-00f067aa0ba902b7`})
+			So(err, ShouldBeNil)
+			So(hex.EncodeToString(res.Thread.Bytes()), ShouldEqual, `0000000000000000a3ce929d0e0e4736`)
+			So(res.Sampling, ShouldEqual, SamplingUndecided)
+		})
+
+		Convey("Sampling", func() {
+			dropped := *shadow
+			dropped.Sampling = SamplingDrop
+
+			c := MapCarrier{}
+			B3{}.Inject(&dropped, c)
+			So(c.Get(HeaderB3Sampled), ShouldEqual, `0`)
+			res, _ := B3{}.Extract(c)
+			So(res.Sampling, ShouldEqual, SamplingDrop)
+
+			c = MapCarrier{}
+			B3{SingleHeader: true}.Inject(&dropped, c)
+			So(c.Get(HeaderB3), ShouldEqual, traceID+`-`+span+`-0`)
+			res, _ = B3{}.Extract(c)
+			So(res.Sampling, ShouldEqual, SamplingDrop)
+
+			res, _ = B3{}.Extract(MapCarrier{`b3`: traceID + `-` + span + `-d`})
+			So(res.Sampling, ShouldEqual, SamplingKeep)
+		})
+
+		Convey("Sampling only", func() {
+			res, err := B3{}.Extract(MapCarrier{`b3`: `0`})
+			So(err, ShouldBeNil)
+			So(res.Sampling, ShouldEqual, SamplingDrop)
+			So(uuid.Equal(res.Thread, uuid.Nil), ShouldBeTrue)
+
+			res, err = B3{}.Extract(MapCarrier{HeaderB3Sampled: `1`})
+			So(err, ShouldBeNil)
+			So(res.Sampling, ShouldEqual, SamplingKeep)
+
+			log := NewLog(`log`)
+			thread := log.Thread
+			log.ParentFromShadow(&LogParentShadow{Sampling: SamplingDrop})
+			So(log.Parent, ShouldBeNil)
+			So(log.Thread, ShouldEqual, thread)
+			So(log.Sampled(), ShouldBeFalse)
+		})
+
+		Convey("Errors", func() {
+			_, err := B3{}.Extract(MapCarrier{})
+			So(err, ShouldEqual, ErrorShadowNotFound)
+
+			_, err = B3{}.Extract(MapCarrier{`b3`: `x`})
+			So(err, ShouldEqual, ErrorShadowInvalid)
+
+			_, err = B3{}.Extract(MapCarrier{HeaderB3TraceID: traceID})
+			So(err, ShouldEqual, ErrorShadowInvalid)
+		})
+	})
+}
+
+func TestCompositePropagator(t *testing.T) {
+
+	Convey("Composite", t, func() {
+		log := NewLog(`test log`)
+		p := DefaultPropagator()
+
+		So(p.Fields(), ShouldResemble, []string{HeaderTraceParent, HeaderTraceState, HeaderB3TraceID, HeaderB3SpanID, HeaderB3Sampled})
+
+		Convey("Inject all", func() {
+			c := MapCarrier{}
+			p.Inject(log.ToShadow(), c)
+
+			So(c.Get(HeaderTraceParent), ShouldNotBeEmpty)
+			So(c.Get(HeaderB3TraceID), ShouldNotBeEmpty)
+
+			expected := log.ToShadow()
+			expected.Sampling = SamplingKeep
+
+			res, err := p.Extract(c)
+			So(err, ShouldBeNil)
+			So(res, ShouldResemble, expected)
+		})
+
+		Convey("Extract by fallback", func() {
+			c := MapCarrier{}
+			B3{}.Inject(log.ToShadow(), c)
+
+			res, err := p.Extract(c)
+			So(err, ShouldBeNil)
+			So(res.Thread, ShouldEqual, log.Thread)
+		})
+
+		Convey("Extract errors", func() {
+			_, err := p.Extract(MapCarrier{})
+			So(err, ShouldEqual, ErrorShadowNotFound)
+
+			_, err = p.Extract(MapCarrier{HeaderTraceParent: `bad`})
+			So(err, ShouldEqual, ErrorShadowInvalid)
+		})
+
+		Convey("Log continues thread", func() {
+			c := MapCarrier{}
+			p.Inject(log.ToShadow(), c)
+
+			shadow, _ := p.Extract(c)
+			remote := NewLog(`remote`).ParentFromShadow(shadow)
+
+			So(remote.Thread, ShouldEqual, log.Thread)
+			So(remote.Parent.ID, ShouldEqual, log.ID)
+			So(remote.Thread, ShouldNotEqual, uuid.Nil)
+		})
+	})
+}
@@ -0,0 +1,364 @@
+package tracefall
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DataRedacted is path in Log.Data of count of fields which were redacted
+const DataRedacted = `_meta.redacted`
+
+// DefaultRedactMask replaces redacted values
+const DefaultRedactMask = `[REDACTED]`
+
+// Patterns of usual sensitive values
+var (
+	PatternEmail      = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`)
+	PatternCardNumber = regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`)
+	PatternURLSecret  = regexp.MustCompile(`(?i)[?&](?:access_token|token|api_key|apikey|key|password|secret|signature)=([^&#\s]+)`)
+	PatternBearer     = regexp.MustCompile(`(?i)bearer\s+([a-zA-Z0-9\-._~+/]+=*)`)
+)
+
+// patternValidators check matches of the usual patterns (see Pattern): matches which are not valid are kept
+var patternValidators = map[*regexp.Regexp]func(match string) bool{
+	PatternCardNumber: ValidLuhn,
+}
+
+// ValidLuhn return true if digits of the number pass the Luhn check. Spaces and dashes are skipped
+func ValidLuhn(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		switch {
+		case c == ' ' || c == '-':
+			continue
+		case c < '0' || c > '9':
+			return false
+		}
+
+		d := int(c - '0')
+		if digits%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits > 1 && sum%10 == 0
+}
+
+// redactPattern is pattern of sensitive values. Matches are redacted when valid is nil or returns true
+type redactPattern struct {
+	re    *regexp.Regexp
+	valid func(match string) bool
+}
+
+// Redactor replaces sensitive values of Name, Error, Data and Notes of the log before it is sent to driver.
+// Values are masked by default or hashed (see Hash), so equal values still may be correlated.
+// Structs, typed maps and slices (map[string]string, http.Header) of Data and note attributes are redacted
+// by their json: keys and paths are json names, redacted value is replaced by its json tree.
+// Rules have to be set up before the Redactor is used
+type Redactor struct {
+	keys     map[string]bool
+	patterns []redactPattern
+	paths    [][]string
+	mask     string
+	hash     bool
+	salt     string
+}
+
+// NewRedactor create new Redactor without rules
+func NewRedactor() *Redactor {
+	return &Redactor{keys: make(map[string]bool), mask: DefaultRedactMask}
+}
+
+// DenyKeys redact values of Data and note attributes by key names (case-insensitive) at any depth
+func (r *Redactor) DenyKeys(keys ...string) *Redactor {
+	for _, key := range keys {
+		r.keys[strings.ToLower(key)] = true
+	}
+	return r
+}
+
+// Pattern redact matches of the pattern in Name, Error, notes, string and number values of Data.
+// When the pattern has capture group, only the first group of the match is redacted.
+// Matches of PatternCardNumber are redacted only if they pass the Luhn check
+func (r *Redactor) Pattern(patterns ...*regexp.Regexp) *Redactor {
+	for _, re := range patterns {
+		r.patterns = append(r.patterns, redactPattern{re: re, valid: patternValidators[re]})
+	}
+	return r
+}
+
+// PatternFunc redact matches of the pattern like Pattern, but only matches which are valid by the function
+func (r *Redactor) PatternFunc(re *regexp.Regexp, valid func(match string) bool) *Redactor {
+	r.patterns = append(r.patterns, redactPattern{re: re, valid: valid})
+	return r
+}
+
+// Path redact values of Data by paths: `http.request.headers.authorization`.
+// Leading `$.` is allowed, `*` matches any key or element of list
+func (r *Redactor) Path(paths ...string) *Redactor {
+	for _, path := range paths {
+		path = strings.TrimPrefix(strings.TrimPrefix(path, `$`), PathSeparator)
+		if path != `` {
+			r.paths = append(r.paths, strings.Split(path, PathSeparator))
+		}
+	}
+	return r
+}
+
+// Mask set mask which replaces redacted values
+func (r *Redactor) Mask(mask string) *Redactor {
+	r.mask = mask
+	r.hash = false
+	return r
+}
+
+// Hash replace redacted values by salted sha256 hash instead of the mask
+func (r *Redactor) Hash(salt string) *Redactor {
+	r.hash = true
+	r.salt = salt
+	return r
+}
+
+// Redact return snapshot of the log with redacted values
+func (r *Redactor) Redact(l *Log) *Log {
+	s := l.Snapshot()
+	r.apply(s)
+	return s
+}
+
+// apply redact the log which is owned by caller (snapshot). Return count of redacted fields
+func (r *Redactor) apply(l *Log) int {
+	count := 0
+
+	if name, n := r.redactString(l.Name); n > 0 {
+		l.Name = name
+		count += n
+	}
+
+	if l.Error != nil {
+		info := l.ErrorInfo
+		if info == nil || info.Message != l.Error.Error() {
+			// redacted error keeps type and chain of the original one
+			info = NewErrorInfo(l.Error)
+		}
+		if n := r.redactErrorInfo(info); n > 0 {
+			l.Error = info
+			count += n
+		}
+	}
+
+	for key, val := range l.data {
+		l.data[key], count = r.redactData(val, matchPaths(r.paths, key), key, count)
+	}
+
+	for _, ng := range l.notes {
+		for _, note := range ng.Notes {
+			if note == nil {
+				continue
+			}
+			count += r.redactNote(note)
+		}
+	}
+
+	if count > 0 {
+		if l.data == nil {
+			l.data = NewExtraData()
+		}
+		l.data.Set(DataRedacted, count)
+	}
+
+	return count
+}
+
+func (r *Redactor) redactNote(note *Note) int {
+	count := 0
+
+	if text, n := r.redactString(note.Note); n > 0 {
+		note.Note = text
+		count += n
+	}
+	if text, n := r.redactString(note.Error); n > 0 {
+		note.Error = text
+		count += n
+	}
+	for key, val := range note.Attrs {
+		note.Attrs[key], count = r.redactData(val, nil, key, count)
+	}
+
+	return count
+}
+
+func (r *Redactor) redactErrorInfo(info *ErrorInfo) int {
+	count := 0
+
+	if msg, n := r.redactString(info.Message); n > 0 {
+		info.Message = msg
+		count += n
+	}
+	for i := range info.Chain {
+		if msg, n := r.redactString(info.Chain[i].Message); n > 0 {
+			info.Chain[i].Message = msg
+			count += n
+		}
+	}
+
+	return count
+}
+
+// redactData redact value of data tree under the key. Paths are the rest of the path rules which lead to the value
+func (r *Redactor) redactData(val interface{}, paths [][]string, key string, count int) (interface{}, int) {
+	for _, p := range paths {
+		if len(p) == 0 {
+			return r.replace(val), count + 1
+		}
+	}
+	if r.keys[strings.ToLower(key)] {
+		return r.replace(val), count + 1
+	}
+
+	switch v := val.(type) {
+	case string:
+		s, n := r.redactString(v)
+		return s, count + n
+	case json.Number, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		// numbers are matched by their text (card number as int64), redacted number is replaced by string
+		if s, n := r.redactString(numberString(v)); n > 0 {
+			return s, count + n
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k], count = r.redactData(item, matchPaths(paths, k), k, count)
+		}
+	case ExtraData:
+		for k, item := range v {
+			v[k], count = r.redactData(item, matchPaths(paths, k), k, count)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i], count = r.redactData(item, matchPaths(paths, `*`), ``, count)
+		}
+	default:
+		// the value is shared with the log, so it is redacted as json tree, which is kept only if something is redacted
+		if tree, ok := dataTree(v); ok {
+			if res, n := r.redactData(tree, paths, key, count); n > count {
+				return res, n
+			}
+		}
+	}
+	return val, count
+}
+
+// numberString return text of the number. Floats are formatted without exponent: 4111111111111111, not 4.111111111111111e+15
+func numberString(v interface{}) string {
+	switch f := v.(type) {
+	case float32:
+		return strconv.FormatFloat(float64(f), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// dataTree convert struct, typed map or slice (map[string]string, http.Header) to data tree by its json.
+// Return false for other values
+func dataTree(val interface{}) (interface{}, bool) {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Array:
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	b, err := json.Marshal(encodeValue(val))
+	if err != nil {
+		return nil, false
+	}
+
+	var tree interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err = dec.Decode(&tree); err != nil {
+		return nil, false
+	}
+	return tree, true
+}
+
+// matchPaths return rests of the paths which match the key
+func matchPaths(paths [][]string, key string) [][]string {
+	var res [][]string
+	for _, p := range paths {
+		if len(p) > 0 && (p[0] == `*` || p[0] == key) {
+			res = append(res, p[1:])
+		}
+	}
+	return res
+}
+
+func (r *Redactor) redactString(s string) (string, int) {
+	if s == `` {
+		return s, 0
+	}
+
+	count := 0
+	for _, p := range r.patterns {
+		re, valid := p.re, p.valid
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			if valid != nil && !valid(match) {
+				return match
+			}
+			count++
+			if re.NumSubexp() == 0 {
+				return r.replace(match)
+			}
+
+			sub := re.FindStringSubmatchIndex(match)
+			if len(sub) < 4 || sub[2] < 0 {
+				return r.replace(match)
+			}
+			return match[:sub[2]] + r.replace(match[sub[2]:sub[3]]) + match[sub[3]:]
+		})
+	}
+	return s, count
+}
+
+func (r *Redactor) replace(val interface{}) string {
+	if !r.hash {
+		return r.mask
+	}
+
+	var str string
+	switch v := val.(type) {
+	case string:
+		str = v
+	case map[string]interface{}, ExtraData, []interface{}:
+		b, _ := json.Marshal(v)
+		str = string(b)
+	default:
+		str = fmt.Sprint(v)
+	}
+
+	sum := sha256.Sum256([]byte(r.salt + str))
+	return `sha256:` + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,188 @@
+package tracefall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedactor(t *testing.T) {
+
+	Convey("Redactor", t, func() {
+		log := NewLog(`user bob@example.com`)
+		log.
+			SetData(`password`, `secret`).
+			SetData(`url`, `https://api.example.com/users?id=1&token=abc123`).
+			SetData(`http.request.headers.authorization`, `Bearer abc.def`).
+			SetData(`http.request.method`, `GET`).
+			SetData(`cards`, []interface{}{`4111 1111 1111 1111`, `no card`}).
+			SetData(`users`, []interface{}{map[string]interface{}{`email`: `a@b.io`, `name`: `a`}}).
+			AddNotes(`auth`, `login of bob@example.com`).
+			NoteWarn(`auth`, `retry`, NewAttr(`Password`, `secret`), NewAttr(`count`, 2))
+		log.Fail(errors.New(`card 4111-1111-1111-1111 declined`))
+
+		Convey("Mask", func() {
+			r := NewRedactor().
+				DenyKeys(`Password`).
+				Pattern(PatternEmail, PatternCardNumber, PatternURLSecret).
+				Path(`$.http.request.headers.authorization`, `users.*.email`)
+
+			snap := r.Redact(log)
+
+			So(snap.Name, ShouldEqual, `user `+DefaultRedactMask)
+			So(snap.Error.Error(), ShouldEqual, `card `+DefaultRedactMask+` declined`)
+			So(snap.GetErrorInfo().Message, ShouldEqual, `card `+DefaultRedactMask+` declined`)
+			So(log.ErrorInfo.Message, ShouldEqual, `card 4111-1111-1111-1111 declined`)
+
+			So(snap.Data().Get(`password`), ShouldEqual, DefaultRedactMask)
+			So(snap.Data().Get(`url`), ShouldEqual, `https://api.example.com/users?id=1&token=`+DefaultRedactMask)
+			So(snap.Data().Get(`http.request.headers.authorization`), ShouldEqual, DefaultRedactMask)
+			So(snap.Data().Get(`http.request.method`), ShouldEqual, `GET`)
+			So(snap.Data().Get(`cards`), ShouldResemble, []interface{}{DefaultRedactMask, `no card`})
+			So(snap.Data().Get(`users`), ShouldResemble, []interface{}{map[string]interface{}{`email`: DefaultRedactMask, `name`: `a`}})
+
+			notes := snap.Notes().Get(`auth`).Notes
+			So(notes[0].Note, ShouldEqual, `login of `+DefaultRedactMask)
+			So(notes[1].Attrs[`Password`], ShouldEqual, DefaultRedactMask)
+			So(notes[1].Attrs[`count`], ShouldEqual, 2)
+
+			So(snap.Data().Get(DataRedacted), ShouldEqual, 9)
+
+			So(log.Name, ShouldEqual, `user bob@example.com`)
+			So(log.Data().Get(`password`), ShouldEqual, `secret`)
+			So(log.Notes().Get(`auth`).Notes[1].Attrs[`Password`], ShouldEqual, `secret`)
+			So(log.Data().Get(DataRedacted), ShouldBeNil)
+		})
+
+		Convey("Hash", func() {
+			r := NewRedactor().DenyKeys(`password`).Pattern(PatternEmail).Hash(`salt`)
+
+			snap := r.Redact(log)
+			hashed := snap.Data().Get(`password`).(string)
+			So(hashed, ShouldStartWith, `sha256:`)
+			So(len(hashed), ShouldEqual, len(`sha256:`)+16)
+			So(snap.Notes().Get(`auth`).Notes[1].Attrs[`Password`], ShouldEqual, hashed)
+			So(snap.Name, ShouldEqual, `user `+strings.TrimPrefix(snap.Notes().Get(`auth`).Notes[0].Note, `login of `))
+
+			other := NewRedactor().DenyKeys(`password`).Hash(`other salt`).Redact(log)
+			So(other.Data().Get(`password`), ShouldNotEqual, hashed)
+		})
+
+		Convey("Capture group", func() {
+			r := NewRedactor().Pattern(regexp.MustCompile(`id=(\d+)`)).Mask(`***`)
+
+			snap := r.Redact(log)
+			So(snap.Data().Get(`url`), ShouldEqual, `https://api.example.com/users?id=***&token=abc123`)
+			So(snap.Data().Get(DataRedacted), ShouldEqual, 1)
+		})
+
+		Convey("Card numbers are checked by Luhn", func() {
+			l := NewLog(`cards 4111 1111 1111 1111, 4111 1111 1111 1112 and order 1234567890123`)
+
+			snap := NewRedactor().Pattern(PatternCardNumber).Redact(l)
+			So(snap.Name, ShouldEqual, `cards `+DefaultRedactMask+`, 4111 1111 1111 1112 and order 1234567890123`)
+
+			So(ValidLuhn(`4111-1111-1111-1111`), ShouldBeTrue)
+			So(ValidLuhn(`5500 0000 0000 0004`), ShouldBeTrue)
+			So(ValidLuhn(`4111 1111 1111 1112`), ShouldBeFalse)
+			So(ValidLuhn(`4111x1111`), ShouldBeFalse)
+			So(ValidLuhn(`0`), ShouldBeFalse)
+
+			custom := NewRedactor().PatternFunc(regexp.MustCompile(`\d+`), func(match string) bool { return len(match) > 3 })
+			So(custom.Redact(NewLog(`12 1234`)).Name, ShouldEqual, `12 `+DefaultRedactMask)
+		})
+
+		Convey("Structs and typed maps", func() {
+			type credentials struct {
+				User     string `json:"user"`
+				Password string `json:"password"`
+				Email    string `json:"email"`
+			}
+
+			header := http.Header{}
+			header.Set(`Authorization`, `Bearer abc`)
+			header.Set(`Accept`, `text/plain`)
+			creds := &credentials{User: `bob`, Password: `secret`, Email: `bob@example.com`}
+			labels := map[string]string{`token`: `abc`, `team`: `core`}
+			kept := struct{ Team string }{Team: `core`}
+
+			l := NewLog(`typed`)
+			l.
+				SetData(`header`, header).
+				SetData(`creds`, creds).
+				SetData(`labels`, labels).
+				SetData(`kept`, kept).
+				SetData(`raw`, []byte(`password`))
+
+			snap := NewRedactor().DenyKeys(`authorization`, `password`, `token`).Pattern(PatternEmail).Redact(l)
+
+			So(snap.Data().Get(`header`), ShouldResemble, map[string]interface{}{
+				`Authorization`: DefaultRedactMask,
+				`Accept`:        []interface{}{`text/plain`},
+			})
+			So(snap.Data().Get(`creds`), ShouldResemble, map[string]interface{}{
+				`user`: `bob`, `password`: DefaultRedactMask, `email`: DefaultRedactMask,
+			})
+			So(snap.Data().Get(`labels`), ShouldResemble, map[string]interface{}{`token`: DefaultRedactMask, `team`: `core`})
+			So(snap.Data().Get(`kept`), ShouldResemble, kept)
+			So(snap.Data().Get(`raw`), ShouldResemble, []byte(`password`))
+			So(snap.Data().Get(DataRedacted), ShouldEqual, 4)
+
+			So(header.Get(`Authorization`), ShouldEqual, `Bearer abc`)
+			So(creds.Password, ShouldEqual, `secret`)
+			So(labels[`token`], ShouldEqual, `abc`)
+
+			snap = NewRedactor().Path(`header.Accept.*`).Redact(l)
+			So(snap.Data().Get(`header.Accept`), ShouldResemble, []interface{}{DefaultRedactMask})
+		})
+
+		Convey("Numbers", func() {
+			l := NewLog(`numbers`)
+			l.SetData(`card`, int64(4111111111111111)).
+				SetData(`float`, float64(4111111111111111)).
+				SetData(`json`, json.Number(`4111111111111111`)).
+				SetData(`count`, 42).
+				SetData(`order`, int64(1234567890123)).
+				AddNote(`pay`, NewNote(`paid`).AddAttrs(NewAttr(`card`, uint64(5500000000000004))))
+
+			snap := NewRedactor().Pattern(PatternCardNumber).Redact(l)
+			So(snap.Data().Get(`card`), ShouldEqual, DefaultRedactMask)
+			So(snap.Data().Get(`float`), ShouldEqual, DefaultRedactMask)
+			So(snap.Data().Get(`json`), ShouldEqual, DefaultRedactMask)
+			So(snap.Data().Get(`count`), ShouldEqual, 42)
+			So(snap.Data().Get(`order`), ShouldEqual, int64(1234567890123))
+			So(snap.NoteGroup(`pay`).Notes[0].Attrs[`card`], ShouldEqual, DefaultRedactMask)
+			So(snap.Data().Get(DataRedacted), ShouldEqual, 4)
+		})
+
+		Convey("Error without ErrorInfo", func() {
+			cause := &os.PathError{Op: `open`, Path: `/home/bob@example.com`, Err: os.ErrNotExist}
+			l := NewLog(`error`)
+			l.Error = fmt.Errorf(`load of bob@example.com: %w`, cause)
+
+			snap := NewRedactor().Pattern(PatternEmail).Redact(l)
+			So(snap.Error.Error(), ShouldEqual, `load of `+DefaultRedactMask+`: open /home/`+DefaultRedactMask+`: file does not exist`)
+
+			info, ok := snap.Error.(*ErrorInfo)
+			So(ok, ShouldBeTrue)
+			So(info.Type, ShouldEqual, `*fmt.wrapError`)
+			So(info.Chain, ShouldHaveLength, 2)
+			So(info.Chain[0].Type, ShouldEqual, `*fs.PathError`)
+			So(info.Chain[0].Message, ShouldEqual, `open /home/`+DefaultRedactMask+`: file does not exist`)
+			So(l.Error.Error(), ShouldContainSubstring, `bob@example.com`)
+		})
+
+		Convey("Nothing to redact", func() {
+			snap := NewRedactor().DenyKeys(`absent`).Redact(log)
+			So(snap.Data().Get(DataRedacted), ShouldBeNil)
+			So(snap.Data().Get(`password`), ShouldEqual, `secret`)
+		})
+	})
+}
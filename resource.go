@@ -0,0 +1,131 @@
+package tracefall
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Environment variables which are read by DetectResource
+const (
+	EnvApp         = `TRACEFALL_APP`
+	EnvEnvironment = `TRACEFALL_ENV`
+)
+
+// Kubernetes hints: variables usually set by the downward API
+var (
+	envPod       = []string{`POD_NAME`, `K8S_POD_NAME`}
+	envNamespace = []string{`POD_NAMESPACE`, `K8S_NAMESPACE`, `K8S_POD_NAMESPACE`}
+	envNode      = []string{`NODE_NAME`, `K8S_NODE_NAME`}
+	envContainer = []string{`CONTAINER_NAME`, `K8S_CONTAINER_NAME`}
+)
+
+const k8sNamespaceFile = `/var/run/secrets/kubernetes.io/serviceaccount/namespace`
+
+// Resource describes the process which makes logs: application, host, build and container.
+// It is shared by logs, so it must not be changed after it is set
+type Resource struct {
+	App          string            `json:"app,omitempty"`
+	Environment  string            `json:"env,omitempty"`
+	Host         string            `json:"host,omitempty"`
+	PID          int               `json:"pid,omitempty"`
+	GoVersion    string            `json:"goVersion,omitempty"`
+	Module       string            `json:"module,omitempty"`
+	Version      string            `json:"version,omitempty"`
+	Revision     string            `json:"revision,omitempty"`
+	RevisionTime string            `json:"revisionTime,omitempty"`
+	Modified     bool              `json:"modified,omitempty"`
+	Pod          string            `json:"pod,omitempty"`
+	Namespace    string            `json:"namespace,omitempty"`
+	Node         string            `json:"node,omitempty"`
+	Container    string            `json:"container,omitempty"`
+	Attrs        map[string]string `json:"attrs,omitempty"`
+}
+
+// DetectResource make Resource of current process: hostname, PID, Go version, module build info and VCS revision,
+// Kubernetes hints, application and environment from TRACEFALL_APP and TRACEFALL_ENV variables
+func DetectResource() *Resource {
+	return detectResource(os.Getenv, debug.ReadBuildInfo, os.ReadFile)
+}
+
+func detectResource(getenv func(string) string, buildInfo func() (*debug.BuildInfo, bool), readFile func(string) ([]byte, error)) *Resource {
+	r := &Resource{
+		App:         getenv(EnvApp),
+		Environment: getenv(EnvEnvironment),
+		PID:         os.Getpid(),
+		GoVersion:   runtime.Version(),
+		Pod:         firstEnv(getenv, envPod),
+		Namespace:   firstEnv(getenv, envNamespace),
+		Node:        firstEnv(getenv, envNode),
+		Container:   firstEnv(getenv, envContainer),
+	}
+
+	if host, err := os.Hostname(); err == nil {
+		r.Host = host
+	}
+
+	if getenv(`KUBERNETES_SERVICE_HOST`) != `` {
+		if r.Pod == `` {
+			r.Pod = getenv(`HOSTNAME`)
+		}
+		if r.Namespace == `` {
+			if b, err := readFile(k8sNamespaceFile); err == nil {
+				r.Namespace = strings.TrimSpace(string(b))
+			}
+		}
+	}
+
+	if info, ok := buildInfo(); ok && info != nil {
+		r.Module = info.Main.Path
+		if info.Main.Version != `(devel)` {
+			r.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case `vcs.revision`:
+				r.Revision = s.Value
+			case `vcs.time`:
+				r.RevisionTime = s.Value
+			case `vcs.modified`:
+				r.Modified = s.Value == `true`
+			}
+		}
+	}
+
+	return r
+}
+
+func firstEnv(getenv func(string) string, keys []string) string {
+	for _, key := range keys {
+		if val := getenv(key); val != `` {
+			return val
+		}
+	}
+	return ``
+}
+
+var resource struct {
+	sync.Mutex
+	r *Resource
+}
+
+// SetResource set Resource of the process which new root logs get. Nil resets it to detected one
+func SetResource(r *Resource) {
+	resource.Lock()
+	defer resource.Unlock()
+
+	resource.r = r
+}
+
+// GetResource return Resource of the process. It is detected on first call if it is not set
+func GetResource() *Resource {
+	resource.Lock()
+	defer resource.Unlock()
+
+	if resource.r == nil {
+		resource.r = DetectResource()
+	}
+	return resource.r
+}
@@ -0,0 +1,92 @@
+package tracefall
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResource(t *testing.T) {
+
+	Convey("Detect Resource", t, func() {
+		env := map[string]string{
+			EnvApp:                    `billing`,
+			EnvEnvironment:            EnvironmentProd,
+			`KUBERNETES_SERVICE_HOST`: `10.0.0.1`,
+			`HOSTNAME`:                `billing-7d9f-x2`,
+			`K8S_NODE_NAME`:           `node-1`,
+		}
+		getenv := func(key string) string { return env[key] }
+		buildInfo := func() (*debug.BuildInfo, bool) {
+			return &debug.BuildInfo{
+				Main: debug.Module{Path: `example.com/billing`, Version: `v1.2.3`},
+				Settings: []debug.BuildSetting{
+					{Key: `vcs.revision`, Value: `abc123`},
+					{Key: `vcs.time`, Value: `2019-01-01T00:00:00Z`},
+					{Key: `vcs.modified`, Value: `true`},
+				},
+			}, true
+		}
+		readFile := func(name string) ([]byte, error) {
+			if name == k8sNamespaceFile {
+				return []byte("payments\n"), nil
+			}
+			return nil, errors.New(`not found`)
+		}
+
+		r := detectResource(getenv, buildInfo, readFile)
+
+		So(r.App, ShouldEqual, `billing`)
+		So(r.Environment, ShouldEqual, EnvironmentProd)
+		So(r.PID, ShouldEqual, os.Getpid())
+		So(r.GoVersion, ShouldEqual, runtime.Version())
+		So(r.Host, ShouldNotBeEmpty)
+		So(r.Module, ShouldEqual, `example.com/billing`)
+		So(r.Version, ShouldEqual, `v1.2.3`)
+		So(r.Revision, ShouldEqual, `abc123`)
+		So(r.RevisionTime, ShouldEqual, `2019-01-01T00:00:00Z`)
+		So(r.Modified, ShouldBeTrue)
+		So(r.Pod, ShouldEqual, `billing-7d9f-x2`)
+		So(r.Namespace, ShouldEqual, `payments`)
+		So(r.Node, ShouldEqual, `node-1`)
+
+		Convey("Without hints", func() {
+			r := detectResource(func(string) string { return `` }, func() (*debug.BuildInfo, bool) { return nil, false }, readFile)
+
+			So(r.App, ShouldBeEmpty)
+			So(r.Pod, ShouldBeEmpty)
+			So(r.Namespace, ShouldBeEmpty)
+			So(r.Module, ShouldBeEmpty)
+			So(r.PID, ShouldEqual, os.Getpid())
+		})
+	})
+
+	Convey("Logs inherit Resource", t, func() {
+		So(GetResource(), ShouldNotBeNil)
+		So(GetResource(), ShouldEqual, GetResource())
+
+		r := &Resource{App: `billing`, Environment: EnvironmentProd, Host: `host`}
+		SetResource(r)
+		defer SetResource(nil)
+
+		root := NewLog(`root`)
+		So(root.Resource, ShouldEqual, r)
+		So(root.App, ShouldEqual, `billing`)
+		So(root.Environment, ShouldEqual, EnvironmentProd)
+
+		child, _ := root.CreateChild(`child`)
+		So(child.Resource, ShouldEqual, r)
+		So(child.Snapshot().Resource, ShouldEqual, r)
+
+		restored, err := root.ToLogJSON().ToLog()
+		So(err, ShouldBeNil)
+		So(restored.Resource, ShouldResemble, r)
+		So(restored.Data().Get(`host`), ShouldBeNil)
+
+		So(NewLog(`other`).SetResource(nil).Resource, ShouldBeNil)
+	})
+}
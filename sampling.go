@@ -0,0 +1,164 @@
+package tracefall
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+)
+
+// SamplingDecision is decision of head sampling of the thread
+type SamplingDecision uint8
+
+// Sampling decisions. Undecided thread is sampled
+const (
+	SamplingUndecided SamplingDecision = iota
+	SamplingKeep
+	SamplingDrop
+)
+
+// Sampled return true if the thread has to be stored
+func (d SamplingDecision) Sampled() bool {
+	return d != SamplingDrop
+}
+
+// Sampler makes head sampling decision for root log
+type Sampler interface {
+	Sample(l *Log) bool
+}
+
+// SamplerFunc is function which implements Sampler
+type SamplerFunc func(l *Log) bool
+
+// Sample implements Sampler
+func (f SamplerFunc) Sample(l *Log) bool {
+	return f(l)
+}
+
+var sampler struct {
+	sync.RWMutex
+	s Sampler
+}
+
+// SetSampler set global head sampler which decides for root logs of NewLog. Nil turns head sampling off
+func SetSampler(s Sampler) {
+	sampler.Lock()
+	defer sampler.Unlock()
+
+	sampler.s = s
+}
+
+func headSample(l *Log) SamplingDecision {
+	sampler.RLock()
+	s := sampler.s
+	sampler.RUnlock()
+
+	if s == nil {
+		return SamplingUndecided
+	}
+	if s.Sample(l) {
+		return SamplingKeep
+	}
+	return SamplingDrop
+}
+
+// AlwaysSample return Sampler which keeps all threads
+func AlwaysSample() Sampler {
+	return SamplerFunc(func(*Log) bool { return true })
+}
+
+// NeverSample return Sampler which drops all threads
+func NeverSample() Sampler {
+	return SamplerFunc(func(*Log) bool { return false })
+}
+
+// RatioSampler return Sampler which keeps the ratio (0..1) of threads.
+// Decision depends on the thread ID only, so it is the same for the thread everywhere
+func RatioSampler(ratio float64) Sampler {
+	if ratio >= 1 {
+		return AlwaysSample()
+	}
+	if ratio <= 0 {
+		return NeverSample()
+	}
+
+	bound := uint64(ratio * (1 << 63))
+	return SamplerFunc(func(l *Log) bool {
+		return binary.BigEndian.Uint64(l.Thread.Bytes()[:8])>>1 < bound
+	})
+}
+
+// RateLimitSampler keeps up to limit threads per second for every pair of application and log name.
+// It is token bucket with burst equals to the limit, but not less than one thread: so fractional limit (0.1 is
+// a thread per 10 seconds) keeps threads too. Bucket is full again after burst/limit seconds without logs,
+// so such idle buckets are removed. Limit which is not positive drops all threads
+type RateLimitSampler struct {
+	limit float64
+	burst float64
+	idle  time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	purgeAt time.Time
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimitSampler create new RateLimitSampler
+func NewRateLimitSampler(limit float64) *RateLimitSampler {
+	s := &RateLimitSampler{
+		limit:   limit,
+		burst:   math.Max(1, limit),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+	if limit > 0 {
+		s.idle = time.Duration(s.burst / limit * float64(time.Second))
+	}
+	return s
+}
+
+// Sample implements Sampler
+func (s *RateLimitSampler) Sample(l *Log) bool {
+	if s.limit <= 0 {
+		return false
+	}
+	key := l.App + `/` + l.Name
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.After(s.purgeAt) {
+		s.purge(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: s.burst, last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(s.burst, b.tokens+now.Sub(b.last).Seconds()*s.limit)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// purge remove idle buckets: they are full, as new ones
+func (s *RateLimitSampler) purge(now time.Time) {
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= s.idle {
+			delete(s.buckets, key)
+		}
+	}
+	s.purgeAt = now.Add(time.Second)
+}
@@ -0,0 +1,163 @@
+package tracefall
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHeadSampling(t *testing.T) {
+
+	Convey("Head sampling", t, func() {
+
+		Convey("Without sampler", func() {
+			log := NewLog(`root`)
+			So(log.Sampling, ShouldEqual, SamplingUndecided)
+			So(log.Sampled(), ShouldBeTrue)
+		})
+
+		Convey("Decision is made for root and inherited", func() {
+			calls := 0
+			SetSampler(SamplerFunc(func(l *Log) bool {
+				calls++
+				return l.App != `drop`
+			}))
+			defer SetSampler(nil)
+
+			root := NewLog(`root`)
+			child, _ := root.CreateChild(`child`)
+			So(root.Sampling, ShouldEqual, SamplingUndecided)
+			So(calls, ShouldEqual, 0)
+
+			// decision is made lazily, so the sampler sees application of the log
+			root.SetApplication(`drop`)
+			So(child.Sampled(), ShouldBeFalse)
+			So(root.Sampling, ShouldEqual, SamplingDrop)
+			So(child.Sampling, ShouldEqual, SamplingDrop)
+			So(root.Sampled(), ShouldBeFalse)
+			So(calls, ShouldEqual, 1)
+
+			late, _ := root.CreateChild(`late`)
+			So(late.Sampling, ShouldEqual, SamplingDrop)
+
+			So(root.ToShadow().Sampling, ShouldEqual, SamplingDrop)
+			So(root.Snapshot().Sampling, ShouldEqual, SamplingDrop)
+			So(calls, ShouldEqual, 1)
+
+			kept := NewLog(`keep`)
+			So(kept.ToShadow().Sampling, ShouldEqual, SamplingKeep)
+			So(calls, ShouldEqual, 2)
+
+			remote := NewLog(`keep`).ParentFromShadow(root.ToShadow())
+			So(remote.Sampled(), ShouldBeFalse)
+
+			// continuation of remote thread without decision does not spend the sampler
+			undecided := NewLog(`keep`).SetApplication(`drop`).ParentFromShadow(&LogParentShadow{ID: root.ID, Thread: root.Thread})
+			So(undecided.Sampled(), ShouldBeTrue)
+			So(undecided.ToShadow().Sampling, ShouldEqual, SamplingUndecided)
+			So(calls, ShouldEqual, 2)
+		})
+
+		Convey("Dropped root is not sent", func() {
+			SetSampler(NeverSample())
+			defer SetSampler(nil)
+
+			drv := &recordDriver{}
+			db, err := OpenDB(drvConnector{driver: drv})
+			So(err, ShouldBeNil)
+
+			root := NewLog(`root`)
+			resp, err := db.Send(root)
+			So(err, ShouldBeNil)
+			So(resp.Result, ShouldBeTrue)
+			So(drv.names(), ShouldBeEmpty)
+			So(root.Sampling, ShouldEqual, SamplingDrop)
+		})
+
+		Convey("Always and never", func() {
+			So(AlwaysSample().Sample(NewLog(`log`)), ShouldBeTrue)
+			So(NeverSample().Sample(NewLog(`log`)), ShouldBeFalse)
+		})
+
+		Convey("Ratio", func() {
+			So(RatioSampler(1).Sample(NewLog(`log`)), ShouldBeTrue)
+			So(RatioSampler(0).Sample(NewLog(`log`)), ShouldBeFalse)
+
+			s := RatioSampler(0.25)
+			kept := 0
+			for i := 0; i < 4000; i++ {
+				if s.Sample(NewLog(`log`)) {
+					kept++
+				}
+			}
+			So(kept, ShouldBeBetween, 800, 1200)
+
+			log := NewLog(`log`)
+			decision := s.Sample(log)
+			for i := 0; i < 10; i++ {
+				So(s.Sample(log), ShouldEqual, decision)
+			}
+		})
+
+		Convey("Rate limit", func() {
+			now := time.Now()
+			s := NewRateLimitSampler(2)
+			s.now = func() time.Time { return now }
+
+			a, b := NewLog(`a`), NewLog(`b`)
+			So(s.Sample(a), ShouldBeTrue)
+			So(s.Sample(a), ShouldBeTrue)
+			So(s.Sample(a), ShouldBeFalse)
+			So(s.Sample(b), ShouldBeTrue)
+
+			now = now.Add(500 * time.Millisecond)
+			So(s.Sample(a), ShouldBeTrue)
+			So(s.Sample(a), ShouldBeFalse)
+
+			now = now.Add(time.Hour)
+			So(s.Sample(a), ShouldBeTrue)
+			So(s.Sample(a), ShouldBeTrue)
+			So(s.Sample(a), ShouldBeFalse)
+			So(s.buckets, ShouldHaveLength, 1)
+
+			now = now.Add(500 * time.Millisecond)
+			So(s.Sample(b), ShouldBeTrue)
+			So(s.buckets, ShouldHaveLength, 2)
+
+			now = now.Add(1500 * time.Millisecond)
+			So(s.Sample(NewLog(`c`)), ShouldBeTrue)
+			So(s.buckets, ShouldHaveLength, 1)
+		})
+
+		Convey("Fractional rate limit", func() {
+			now := time.Now()
+			s := NewRateLimitSampler(0.2)
+			s.now = func() time.Time { return now }
+
+			l := NewLog(`a`)
+			So(s.Sample(l), ShouldBeTrue)
+			So(s.Sample(l), ShouldBeFalse)
+
+			now = now.Add(4 * time.Second)
+			So(s.Sample(l), ShouldBeFalse)
+
+			now = now.Add(time.Second)
+			So(s.Sample(l), ShouldBeTrue)
+			So(s.Sample(l), ShouldBeFalse)
+
+			// bucket is not full after a second, so it is kept
+			now = now.Add(2 * time.Second)
+			So(s.Sample(NewLog(`b`)), ShouldBeTrue)
+			So(s.buckets, ShouldHaveLength, 2)
+
+			now = now.Add(5 * time.Second)
+			So(s.Sample(NewLog(`c`)), ShouldBeTrue)
+			So(s.buckets, ShouldHaveLength, 1)
+		})
+
+		Convey("Zero rate limit", func() {
+			So(NewRateLimitSampler(0).Sample(NewLog(`a`)), ShouldBeFalse)
+		})
+	})
+}
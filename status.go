@@ -0,0 +1,101 @@
+package tracefall
+
+import (
+	"context"
+	"errors"
+)
+
+// Status of the log
+type Status string
+
+// Statuses. The log is pending until it is finished by Success, Fail, Cancel, Timeout or Skip
+const (
+	StatusPending   Status = `pending`
+	StatusSuccess   Status = `success`
+	StatusFailed    Status = `failed`
+	StatusCancelled Status = `cancelled`
+	StatusTimeout   Status = `timeout`
+	StatusSkipped   Status = `skipped`
+)
+
+// Finished return true if the log is finished
+func (s Status) Finished() bool {
+	return s != StatusPending && s != ``
+}
+
+// Failed return true if the log is failed or timed out
+func (s Status) Failed() bool {
+	return s == StatusFailed || s == StatusTimeout
+}
+
+// StatusFromResult return status of the log which has no status: made before statuses or restored from old JSON
+func StatusFromResult(result, finished bool) Status {
+	switch {
+	case !finished:
+		return StatusPending
+	case result:
+		return StatusSuccess
+	default:
+		return StatusFailed
+	}
+}
+
+// statusOfError return status of the log which is failed by the error: context errors mean timeout and cancel
+func statusOfError(err error) Status {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return StatusTimeout
+	case errors.Is(err, context.Canceled):
+		return StatusCancelled
+	default:
+		return StatusFailed
+	}
+}
+
+// Cancel finish the log with cancelled status. The argument err is the reason, it may be nil
+func (l *Log) Cancel(err error) *Log {
+	return l.finish(StatusCancelled, err)
+}
+
+// Timeout finish the log with timeout status. The argument err is the reason, context.DeadlineExceeded is set if it is nil
+func (l *Log) Timeout(err error) *Log {
+	if err == nil {
+		err = context.DeadlineExceeded
+	}
+	return l.finish(StatusTimeout, err)
+}
+
+// Skip finish the log with skipped status: the work was not done, and it is not failure
+func (l *Log) Skip() *Log {
+	return l.finish(StatusSkipped, nil)
+}
+
+func (l *Log) finish(status Status, err error) *Log {
+	l.mu.Lock()
+	l.Result = false
+	l.Status = status
+	l.Error = err
+	l.ErrorInfo = NewErrorInfo(err)
+	l.finishTimeEnd()
+	l.mu.Unlock()
+
+	getProcessors().onFinish(l)
+	return l
+}
+
+// GetStatus return status of the log. Status of the log without it is made from Result and TimeEnd
+func (l *Log) GetStatus() Status {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.getStatus()
+}
+
+// getStatus return status of the log. The log which has finish time without status of finish
+// (TimeEnd is set directly or by FinishTimeEnd) has status by its result, as old rows which are migrated
+func (l *Log) getStatus() Status {
+	if l.Status == `` || (l.Status == StatusPending && l.TimeEnd != nil) {
+		return StatusFromResult(l.Result, l.TimeEnd != nil)
+	}
+	return l.Status
+}
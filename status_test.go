@@ -0,0 +1,120 @@
+package tracefall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStatus(t *testing.T) {
+
+	Convey("Status", t, func() {
+		So(StatusPending.Finished(), ShouldBeFalse)
+		So(Status(``).Finished(), ShouldBeFalse)
+		So(StatusSkipped.Finished(), ShouldBeTrue)
+
+		So(StatusFailed.Failed(), ShouldBeTrue)
+		So(StatusTimeout.Failed(), ShouldBeTrue)
+		So(StatusCancelled.Failed(), ShouldBeFalse)
+		So(StatusSuccess.Failed(), ShouldBeFalse)
+
+		So(StatusFromResult(false, false), ShouldEqual, StatusPending)
+		So(StatusFromResult(true, true), ShouldEqual, StatusSuccess)
+		So(StatusFromResult(false, true), ShouldEqual, StatusFailed)
+	})
+
+	Convey("Log Status", t, func() {
+		l := NewLog(`log`)
+		So(l.Status, ShouldEqual, StatusPending)
+
+		child, _ := l.CreateChild(`child`)
+		So(child.Status, ShouldEqual, StatusPending)
+
+		Convey("Success", func() {
+			So(l.Success().Status, ShouldEqual, StatusSuccess)
+			So(l.Result, ShouldBeTrue)
+		})
+
+		Convey("Fail", func() {
+			So(l.Fail(errors.New(`fail`)).Status, ShouldEqual, StatusFailed)
+			So(l.Result, ShouldBeFalse)
+		})
+
+		Convey("Fail by context errors", func() {
+			So(l.Fail(fmt.Errorf(`query: %w`, context.DeadlineExceeded)).Status, ShouldEqual, StatusTimeout)
+			So(l.Fail(context.Canceled).Status, ShouldEqual, StatusCancelled)
+		})
+
+		Convey("Cancel, Timeout and Skip", func() {
+			So(l.Cancel(nil).Status, ShouldEqual, StatusCancelled)
+			So(l.Error, ShouldBeNil)
+			So(l.TimeEnd, ShouldNotBeNil)
+
+			So(l.Timeout(nil).Status, ShouldEqual, StatusTimeout)
+			So(errors.Is(l.Error, context.DeadlineExceeded), ShouldBeTrue)
+			So(l.ErrorInfo.Message, ShouldEqual, context.DeadlineExceeded.Error())
+
+			So(l.Skip().Status, ShouldEqual, StatusSkipped)
+			So(l.Result, ShouldBeFalse)
+			So(l.Error, ShouldBeNil)
+		})
+
+		Convey("Finished log is not pending", func() {
+			l.Skip()
+			So(l.Snapshot().Status, ShouldEqual, StatusSkipped)
+		})
+
+		Convey("JSON", func() {
+			l.Timeout(nil)
+
+			lj := l.ToLogJSON()
+			So(lj.Status, ShouldEqual, StatusTimeout)
+
+			restored, err := lj.ToLog()
+			So(err, ShouldBeNil)
+			So(restored.Status, ShouldEqual, StatusTimeout)
+
+			Convey("Old JSON without status", func() {
+				lj.Status = ``
+
+				restored, err := lj.ToLog()
+				So(err, ShouldBeNil)
+				So(restored.Status, ShouldEqual, StatusFailed)
+
+				lj.TimeEnd = nil
+				restored, _ = lj.ToLog()
+				So(restored.Status, ShouldEqual, StatusPending)
+			})
+		})
+
+		Convey("Log without status", func() {
+			l := &Log{Result: true}
+			So(l.GetStatus(), ShouldEqual, StatusPending)
+			So(l.FinishTimeEnd().GetStatus(), ShouldEqual, StatusSuccess)
+			So(l.ToLogJSON().Status, ShouldEqual, StatusSuccess)
+		})
+
+		Convey("Finish time without result", func() {
+			l := NewLog(`finished`)
+			So(l.GetStatus(), ShouldEqual, StatusPending)
+
+			l.FinishTimeEnd()
+			So(l.Status, ShouldEqual, StatusFailed)
+			So(l.ToLogJSON().Status, ShouldEqual, StatusFailed)
+			So(l.SetDefaults().Status, ShouldEqual, StatusFailed)
+
+			l.Success().FinishTimeEnd()
+			So(l.GetStatus(), ShouldEqual, StatusSuccess)
+
+			te := time.Now()
+			direct := NewLog(`direct`)
+			direct.TimeEnd = &te
+			So(direct.GetStatus(), ShouldEqual, StatusFailed)
+			So(direct.Snapshot().GetStatus(), ShouldEqual, StatusFailed)
+		})
+	})
+}
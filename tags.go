@@ -1,11 +1,11 @@
 package tracefall
 
-// Tags struct is list of string
+// Tags struct is list of string. It is not safe for concurrent use: tags of Log are changed only by Log.AddTag
 type Tags []string
 
-// List of tags
+// List return copy of tags
 func (t Tags) List() []string {
-	return []string(t)
+	return append([]string{}, t...)
 }
 
 // Add new Tag by name
@@ -0,0 +1,232 @@
+package tracefall
+
+import (
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Defaults of TailPolicy
+const (
+	DefaultTailWait        = 30 * time.Second
+	DefaultTailThreads     = 10000
+	DefaultTailDecisionTTL = 5 * time.Minute
+)
+
+// TailPolicy describes which threads are kept by tail sampling.
+// Logs of the thread are buffered until one of them matches the policy: then buffered and further logs
+// of the thread are sent. Logs may come in any order (root first too), so the thread is completed only
+// when MaxWait is passed: the thread without matched logs is dropped then. Decision of the completed thread
+// (kept or dropped) is applied to its late logs during DecisionTTL
+type TailPolicy struct {
+	// KeepFailed keeps threads with failed and timed out logs
+	KeepFailed bool
+	// SlowerThan keeps threads with logs longer than the duration (if it is not zero)
+	SlowerThan time.Duration
+	// Tags keeps threads with logs which have any of the tags
+	Tags []string
+
+	// MaxWait is time of buffering of the thread since its first log
+	MaxWait time.Duration
+	// DecisionTTL is time since completion of the thread while its decision is applied to late logs
+	DecisionTTL time.Duration
+	// MaxThreads is limit of buffered threads, the oldest one is completed when the limit is reached.
+	// It is limit of kept decisions too
+	MaxThreads int
+	// OnError is called for errors of deferred sending of buffered logs
+	OnError func(l *Log, err error)
+}
+
+// Match return true if the log makes its thread kept
+func (p *TailPolicy) Match(l *Log) bool {
+	if p.KeepFailed && (l.GetStatus().Failed() || l.Error != nil) && l.TimeEnd != nil {
+		return true
+	}
+	if p.SlowerThan > 0 && l.TimeEnd != nil && l.Duration() > p.SlowerThan {
+		return true
+	}
+	for _, tag := range p.Tags {
+		for _, t := range l.Tags() {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type tailThread struct {
+	logs    []*SendEvent
+	keep    bool
+	started time.Time
+	timer   *time.Timer
+}
+
+// tailDecision is decision of completed thread
+type tailDecision struct {
+	keep    bool
+	expires time.Time
+}
+
+type tailSampler struct {
+	policy TailPolicy
+
+	mu        sync.Mutex
+	threads   map[uuid.UUID]*tailThread
+	decisions map[uuid.UUID]tailDecision
+}
+
+func newTailSampler(policy TailPolicy) *tailSampler {
+	if policy.MaxWait <= 0 {
+		policy.MaxWait = DefaultTailWait
+	}
+	if policy.DecisionTTL <= 0 {
+		policy.DecisionTTL = DefaultTailDecisionTTL
+	}
+	if policy.MaxThreads <= 0 {
+		policy.MaxThreads = DefaultTailThreads
+	}
+	if policy.OnError == nil {
+		policy.OnError = func(*Log, error) {}
+	}
+
+	return &tailSampler{
+		policy:    policy,
+		threads:   make(map[uuid.UUID]*tailThread),
+		decisions: make(map[uuid.UUID]tailDecision),
+	}
+}
+
+// send pass log of the event (which is owned by sampler) to driver of the event or buffer it
+func (s *tailSampler) send(e *SendEvent) (ResponseCmd, error) {
+	l := e.Log
+
+	s.mu.Lock()
+
+	// late log of completed thread
+	if d, ok := s.decisions[l.Thread]; ok && time.Now().Before(d.expires) {
+		s.mu.Unlock()
+
+		if !d.keep {
+			return *NewResponse(l).Success().ToCmd(), nil
+		}
+		return e.Driver.Send(l)
+	}
+
+	t, ok := s.threads[l.Thread]
+	if !ok {
+		t = s.start(l.Thread)
+	}
+
+	var pending []*SendEvent
+	switch {
+	case t.keep:
+		pending = []*SendEvent{e}
+	case s.policy.Match(l):
+		t.keep = true
+		pending = append(t.logs, e)
+		t.logs = nil
+	default:
+		t.logs = append(t.logs, e)
+	}
+
+	s.mu.Unlock()
+
+	if len(pending) == 0 {
+		return *NewResponse(l).Success().ToCmd(), nil
+	}
+
+	for _, p := range pending[:len(pending)-1] {
+		if _, err := p.Driver.Send(p.Log); err != nil {
+			s.policy.OnError(p.Log, err)
+		}
+	}
+	return e.Driver.Send(l)
+}
+
+func (s *tailSampler) start(thread uuid.UUID) *tailThread {
+	if len(s.threads) >= s.policy.MaxThreads {
+		var (
+			oldestID uuid.UUID
+			oldest   *tailThread
+		)
+		for id, t := range s.threads {
+			if oldest == nil || t.started.Before(oldest.started) {
+				oldestID, oldest = id, t
+			}
+		}
+		s.complete(oldestID, oldest)
+	}
+
+	t := &tailThread{started: time.Now()}
+	t.timer = time.AfterFunc(s.policy.MaxWait, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.threads[thread] == t {
+			s.complete(thread, t)
+		}
+	})
+	s.threads[thread] = t
+
+	return t
+}
+
+// complete remove thread from buffer and keep its decision. Logs of not kept thread are dropped
+func (s *tailSampler) complete(thread uuid.UUID, t *tailThread) {
+	t.timer.Stop()
+	t.logs = nil
+	delete(s.threads, thread)
+
+	now := time.Now()
+	if len(s.decisions) >= s.policy.MaxThreads {
+		s.purge(now)
+	}
+	s.decisions[thread] = tailDecision{keep: t.keep, expires: now.Add(s.policy.DecisionTTL)}
+}
+
+// purge remove expired decisions. The oldest decision is removed if all of them are actual
+func (s *tailSampler) purge(now time.Time) {
+	var (
+		oldestID uuid.UUID
+		oldest   *tailDecision
+	)
+	for id, d := range s.decisions {
+		if !now.Before(d.expires) {
+			delete(s.decisions, id)
+			continue
+		}
+		if oldest == nil || d.expires.Before(oldest.expires) {
+			d := d
+			oldestID, oldest = id, &d
+		}
+	}
+
+	if oldest != nil && len(s.decisions) >= s.policy.MaxThreads {
+		delete(s.decisions, oldestID)
+	}
+}
+
+// stop drop all buffered threads and decisions
+func (s *tailSampler) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, t := range s.threads {
+		s.complete(id, t)
+	}
+	s.decisions = make(map[uuid.UUID]tailDecision)
+}
+
+// buffered return count of buffered logs
+func (s *tailSampler) buffered() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, t := range s.threads {
+		count += len(t.logs)
+	}
+	return count
+}
@@ -0,0 +1,166 @@
+package tracefall
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type tailCounts struct {
+	threads, decisions int
+}
+
+// counts return count of buffered threads and decisions
+func (s *tailSampler) counts() tailCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return tailCounts{len(s.threads), len(s.decisions)}
+}
+
+func TestTailSampling(t *testing.T) {
+
+	Convey("DB sampling", t, func() {
+		drv := &recordDriver{}
+		db, err := OpenDB(drvConnector{driver: drv})
+		So(err, ShouldBeNil)
+
+		Convey("Head dropped logs do not reach driver", func() {
+			log := NewLog(`dropped`)
+			log.Sampling = SamplingDrop
+
+			r, err := db.Send(log)
+			So(err, ShouldBeNil)
+			So(r.Result, ShouldBeTrue)
+			So(drv.names(), ShouldBeEmpty)
+
+			_, _ = db.Send(NewLog(`sent`))
+			So(drv.names(), ShouldResemble, []string{`sent`})
+		})
+
+		Convey("Tail", func() {
+			db.SetTailSampling(&TailPolicy{KeepFailed: true, SlowerThan: time.Minute, Tags: []string{`debug`}})
+			defer db.SetTailSampling(nil)
+
+			Convey("thread without matches is dropped", func() {
+				db.SetTailSampling(&TailPolicy{KeepFailed: true, MaxWait: 10 * time.Millisecond})
+
+				root := NewLog(`root`)
+				child, _ := root.CreateChild(`child`)
+
+				_, _ = db.Send(child.Success())
+				So(db.tail.buffered(), ShouldEqual, 1)
+
+				_, _ = db.Send(root.Success())
+				So(db.tail.buffered(), ShouldEqual, 2)
+
+				time.Sleep(50 * time.Millisecond)
+				So(drv.names(), ShouldBeEmpty)
+				So(db.tail.buffered(), ShouldEqual, 0)
+
+				Convey("late logs of dropped thread are dropped", func() {
+					late, _ := root.CreateChild(`late`)
+					_, _ = db.Send(late.Fail(errors.New(`fail`)))
+					So(drv.names(), ShouldBeEmpty)
+					So(db.tail.buffered(), ShouldEqual, 0)
+				})
+			})
+
+			Convey("root first", func() {
+				db.SetTailSampling(&TailPolicy{KeepFailed: true, MaxWait: 10 * time.Millisecond})
+
+				root := NewLog(`root`)
+				_, _ = db.Send(root.Success())
+				So(drv.names(), ShouldBeEmpty)
+
+				failed, _ := root.CreateChild(`failed`)
+				_, _ = db.Send(failed.Fail(errors.New(`fail`)))
+				So(drv.names(), ShouldResemble, []string{`root`, `failed`})
+
+				time.Sleep(50 * time.Millisecond)
+				So(db.tail.counts().threads, ShouldEqual, 0)
+
+				Convey("late logs of kept thread are sent", func() {
+					late, _ := root.CreateChild(`late`)
+					_, _ = db.Send(late.Success())
+					So(drv.names(), ShouldResemble, []string{`root`, `failed`, `late`})
+					So(db.tail.buffered(), ShouldEqual, 0)
+				})
+			})
+
+			Convey("decision expires", func() {
+				db.SetTailSampling(&TailPolicy{KeepFailed: true, MaxWait: 10 * time.Millisecond, DecisionTTL: 10 * time.Millisecond})
+
+				root := NewLog(`root`)
+				_, _ = db.Send(root.Success())
+				time.Sleep(50 * time.Millisecond)
+
+				late, _ := root.CreateChild(`late`)
+				_, _ = db.Send(late.Success())
+				So(db.tail.buffered(), ShouldEqual, 1)
+			})
+
+			Convey("thread with failed log is kept", func() {
+				root := NewLog(`root`)
+				first, _ := root.CreateChild(`first`)
+				failed, _ := root.CreateChild(`failed`)
+				last, _ := root.CreateChild(`last`)
+
+				_, _ = db.Send(first.Success())
+				So(drv.names(), ShouldBeEmpty)
+
+				_, _ = db.Send(failed.Fail(errors.New(`fail`)))
+				So(drv.names(), ShouldResemble, []string{`first`, `failed`})
+
+				_, _ = db.Send(last.Success())
+				_, _ = db.Send(root.Success())
+				So(drv.names(), ShouldResemble, []string{`first`, `failed`, `last`, `root`})
+				So(db.tail.buffered(), ShouldEqual, 0)
+			})
+
+			Convey("slow and tagged logs", func() {
+				slow := NewLog(`slow`)
+				slow.Time = time.Now().Add(-time.Hour)
+				_, _ = db.Send(slow.Success())
+
+				tagged := NewLog(`tagged`)
+				tagged.AddTag(`debug`)
+				_, _ = db.Send(tagged)
+
+				So(drv.names(), ShouldResemble, []string{`slow`, `tagged`})
+			})
+
+			Convey("thread is dropped after wait", func() {
+				db.SetTailSampling(&TailPolicy{KeepFailed: true, MaxWait: 10 * time.Millisecond})
+
+				root := NewLog(`root`)
+				child, _ := root.CreateChild(`child`)
+				_, _ = db.Send(child.Success())
+				So(db.tail.buffered(), ShouldEqual, 1)
+
+				time.Sleep(50 * time.Millisecond)
+				So(db.tail.buffered(), ShouldEqual, 0)
+			})
+
+			Convey("oldest thread is dropped when limit is reached", func() {
+				db.SetTailSampling(&TailPolicy{KeepFailed: true, MaxThreads: 2})
+
+				for i := 0; i < 3; i++ {
+					child, _ := NewLog(`root`).CreateChild(`child`)
+					_, _ = db.Send(child.Success())
+				}
+				So(db.tail.counts().threads, ShouldEqual, 2)
+				So(db.tail.counts().decisions, ShouldEqual, 1)
+
+				for i := 0; i < 3; i++ {
+					child, _ := NewLog(`root`).CreateChild(`child`)
+					_, _ = db.Send(child.Success())
+				}
+				So(db.tail.counts().threads, ShouldEqual, 2)
+				So(db.tail.counts().decisions, ShouldEqual, 2)
+			})
+		})
+	})
+}